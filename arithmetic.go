@@ -0,0 +1,479 @@
+package gobash
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/omerhorev/gobash/rdp"
+)
+
+// The kind of an arithmetic token. Operators are tokens whose kind is the
+// operator itself (like "+" or "<<=").
+type arithTokenKind string
+
+func (k arithTokenKind) Accept(t arithToken) bool {
+	return t.Kind == k
+}
+
+var (
+	arithTokenNumber = arithTokenKind("number")
+	arithTokenName   = arithTokenKind("name")
+	arithTokenEOF    = arithTokenKind("EOF")
+)
+
+// The operators of an arithmetic expression, longer operators first so they are
+// matched before their prefixes
+var arithOperators = []string{
+	"<<=", ">>=",
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "&", "^", "|", "!", "~", "?", ":", "=", "(", ")",
+}
+
+// The assignment operators, mapped to the binary operator they apply
+var arithAssignments = map[arithTokenKind]arithTokenKind{
+	"=":   "",
+	"*=":  "*",
+	"/=":  "/",
+	"%=":  "%",
+	"+=":  "+",
+	"-=":  "-",
+	"<<=": "<<",
+	">>=": ">>",
+	"&=":  "&",
+	"^=":  "^",
+	"|=":  "|",
+}
+
+// The binary operators, from the lowest precedence to the highest. The logical
+// operators (|| and &&) are short-circuited.
+var arithPrecedence = [][]arithTokenKind{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type arithToken struct {
+	Kind  arithTokenKind
+	Value string
+}
+
+func (t arithToken) String() string {
+	if t.Kind == arithTokenEOF {
+		return "EOF"
+	}
+
+	return t.Value
+}
+
+// Splits an arithmetic expression into tokens
+func readArithTokens(expression string) ([]arithToken, error) {
+	tokens := []arithToken{}
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isDigit(r):
+			start := i
+			for i < len(runes) && (isDigit(runes[i]) || unicode.IsLetter(runes[i])) {
+				i++
+			}
+
+			tokens = append(tokens, arithToken{Kind: arithTokenNumber, Value: string(runes[start:i])})
+		case isNameRune(r):
+			start := i
+			for i < len(runes) && isNameRune(runes[i]) {
+				i++
+			}
+
+			tokens = append(tokens, arithToken{Kind: arithTokenName, Value: string(runes[start:i])})
+		default:
+			found := false
+			for _, o := range arithOperators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					tokens = append(tokens, arithToken{Kind: arithTokenKind(o), Value: o})
+					i += len([]rune(o))
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("invalid character '%c'", r)
+			}
+		}
+	}
+
+	return append(tokens, arithToken{Kind: arithTokenEOF}), nil
+}
+
+// Parses an integer constant, in decimal, octal (leading 0) or hexadecimal
+// (leading 0x) notation
+func parseArithNumber(str string) (int64, error) {
+	base := 10
+	digits := str
+
+	if strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X") {
+		base, digits = 16, str[2:]
+	} else if len(str) > 1 && str[0] == '0' {
+		base, digits = 8, str[1:]
+	}
+
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid number", str)
+	}
+
+	return int64(n), nil
+}
+
+// A node of a parsed arithmetic expression
+type arithNode interface {
+	eval(env *ExecEnv) (int64, error)
+}
+
+type arithNumber struct{ Value int64 }
+
+type arithVariable struct{ Name string }
+
+type arithUnary struct {
+	Op    arithTokenKind
+	Value arithNode
+}
+
+type arithBinary struct {
+	Op          arithTokenKind
+	Left, Right arithNode
+}
+
+type arithConditional struct {
+	Cond, True, False arithNode
+}
+
+type arithAssign struct {
+	Name  string
+	Op    arithTokenKind // the binary operator applied, empty for a plain assignment
+	Value arithNode
+}
+
+func (n *arithNumber) eval(env *ExecEnv) (int64, error) {
+	return n.Value, nil
+}
+
+// The value of an unset or null variable is 0
+func (n *arithVariable) eval(env *ExecEnv) (int64, error) {
+	value := strings.TrimSpace(env.GetParam(n.Name))
+	if value == "" {
+		return 0, nil
+	}
+
+	negative := false
+	if value[0] == '-' || value[0] == '+' {
+		negative = value[0] == '-'
+		value = value[1:]
+	}
+
+	x, err := parseArithNumber(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if negative {
+		x = -x
+	}
+
+	return x, nil
+}
+
+func (n *arithUnary) eval(env *ExecEnv) (int64, error) {
+	x, err := n.Value.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.Op {
+	case "-":
+		return -x, nil
+	case "~":
+		return ^x, nil
+	case "!":
+		return arithBool(x == 0), nil
+	}
+
+	return x, nil
+}
+
+func (n *arithBinary) eval(env *ExecEnv) (int64, error) {
+	x, err := n.Left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// the right operand of a logical operator is evaluated only if needed
+	if (n.Op == "&&" && x == 0) || (n.Op == "||" && x != 0) {
+		return arithBool(x != 0), nil
+	}
+
+	y, err := n.Right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	return applyArithOperator(n.Op, x, y)
+}
+
+func (n *arithConditional) eval(env *ExecEnv) (int64, error) {
+	cond, err := n.Cond.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return n.True.eval(env)
+	}
+
+	return n.False.eval(env)
+}
+
+func (n *arithAssign) eval(env *ExecEnv) (int64, error) {
+	value, err := n.Value.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	if n.Op != "" {
+		current, err := (&arithVariable{Name: n.Name}).eval(env)
+		if err != nil {
+			return 0, err
+		}
+
+		if value, err = applyArithOperator(n.Op, current, value); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := env.Assign(n.Name, strconv.FormatInt(value, 10)); err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// Applies a binary operator on the operands
+func applyArithOperator(op arithTokenKind, x, y int64) (int64, error) {
+	switch op {
+	case "||":
+		return arithBool(x != 0 || y != 0), nil
+	case "&&":
+		return arithBool(x != 0 && y != 0), nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "==":
+		return arithBool(x == y), nil
+	case "!=":
+		return arithBool(x != y), nil
+	case "<":
+		return arithBool(x < y), nil
+	case "<=":
+		return arithBool(x <= y), nil
+	case ">":
+		return arithBool(x > y), nil
+	case ">=":
+		return arithBool(x >= y), nil
+	case "<<":
+		return x << (uint64(y) & 63), nil
+	case ">>":
+		return x >> (uint64(y) & 63), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, errors.New("division by zero")
+		}
+
+		if op == "/" {
+			return x / y, nil
+		}
+
+		return x % y, nil
+	}
+
+	return 0, fmt.Errorf("unknown operator %s", op)
+}
+
+func arithBool(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// A recursive descent parser of arithmetic expressions (see 2.6.4 Arithmetic
+// Expansion). The grammar and the precedence of the operators are the ones of
+// the C language, without the increment and decrement operators.
+type arithParser struct {
+	rdp rdp.RDP[arithToken, arithTokenKind]
+}
+
+// Parses an arithmetic expression
+func parseArith(expression string) (arithNode, error) {
+	tokens, err := readArithTokens(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty expression evaluates to zero
+	if len(tokens) == 1 {
+		return &arithNumber{Value: 0}, nil
+	}
+
+	p := arithParser{
+		rdp: rdp.RDP[arithToken, arithTokenKind]{Tokens: tokens},
+	}
+
+	node := p.expression()
+	p.rdp.Expect(arithTokenEOF)
+
+	if p.rdp.Error() != nil {
+		return nil, p.rdp.Error()
+	}
+
+	return node, nil
+}
+
+func (p *arithParser) expression() arithNode {
+	return p.assignment()
+}
+
+func (p *arithParser) assignment() arithNode {
+	if p.rdp.Check(arithTokenName) && p.rdp.Index+1 < len(p.rdp.Tokens) {
+		name := p.rdp.Current().Value
+		if op, ok := arithAssignments[p.rdp.Tokens[p.rdp.Index+1].Kind]; ok {
+			p.rdp.Consume()
+			p.rdp.Consume()
+
+			return &arithAssign{Name: name, Op: op, Value: p.assignment()}
+		}
+	}
+
+	return p.conditional()
+}
+
+func (p *arithParser) conditional() arithNode {
+	cond := p.binary(0)
+
+	if !p.rdp.Accept("?") {
+		return cond
+	}
+
+	node := &arithConditional{Cond: cond}
+	node.True = p.expression()
+
+	if !p.rdp.Expect(":") {
+		return nil
+	}
+
+	p.rdp.Consume()
+	node.False = p.conditional()
+
+	return node
+}
+
+// Parses the binary operators with the precedence provided (an index into
+// arithPrecedence). Binary operators are left associative.
+func (p *arithParser) binary(precedence int) arithNode {
+	if precedence == len(arithPrecedence) {
+		return p.unary()
+	}
+
+	node := p.binary(precedence + 1)
+
+	for p.rdp.Error() == nil && p.rdp.Accept(arithPrecedence[precedence]...) {
+		node = &arithBinary{
+			Op:    p.rdp.Prev().Kind,
+			Left:  node,
+			Right: p.binary(precedence + 1),
+		}
+	}
+
+	return node
+}
+
+func (p *arithParser) unary() arithNode {
+	if p.rdp.Accept("+", "-", "~", "!") {
+		return &arithUnary{Op: p.rdp.Prev().Kind, Value: p.unary()}
+	}
+
+	return p.primary()
+}
+
+func (p *arithParser) primary() arithNode {
+	if p.rdp.Error() != nil {
+		return nil
+	}
+
+	current := p.rdp.Current()
+
+	switch {
+	case p.rdp.Accept(arithTokenNumber):
+		n, err := parseArithNumber(current.Value)
+		if err != nil {
+			p.rdp.SetError(err)
+			return nil
+		}
+
+		return &arithNumber{Value: n}
+	case p.rdp.Accept(arithTokenName):
+		return &arithVariable{Name: current.Value}
+	case p.rdp.Accept("("):
+		node := p.expression()
+		if !p.rdp.Expect(")") {
+			return nil
+		}
+
+		p.rdp.Consume()
+		return node
+	}
+
+	p.rdp.SetError(newSyntaxError(fmt.Errorf("operand expected but found %v", current)))
+	return nil
+}
+
+// Evaluates the arithmetic expression. Variables are read from, and assigned to,
+// the parameters of the environment.
+func evalArith(expression string, env *ExecEnv) (int64, error) {
+	node, err := parseArith(expression)
+	if err != nil {
+		return 0, newExpansionError(fmt.Errorf("%s: %w", strings.TrimSpace(expression), err))
+	}
+
+	value, err := node.eval(env)
+	if err != nil {
+		return 0, newExpansionError(fmt.Errorf("%s: %w", strings.TrimSpace(expression), err))
+	}
+
+	return value, nil
+}
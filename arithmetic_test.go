@@ -0,0 +1,71 @@
+package gobash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArithmetic(t *testing.T) {
+	env := newExecEnv()
+
+	testArith := func(expression string, expected int64) {
+		value, err := evalArith(expression, env)
+		require.NoError(t, err, expression)
+		require.Equal(t, expected, value, expression)
+	}
+
+	testArith("", 0)
+	testArith("  42 ", 42)
+	testArith("010 + 0x10 + 0XfF", 8+16+255)
+	testArith("1 + 2 * 3", 7)
+	testArith("(1 + 2) * 3", 9)
+	testArith("10 - 4 - 3", 3)
+	testArith("7 / 2 + 7 % 2", 4)
+	testArith("-7 / 2 + -7 % 2", -4)
+	testArith("-3 + +2 - -1", 0)
+	testArith("~0 + !0 + !5", 0)
+	testArith("1 << 4 >> 2", 4)
+	testArith("(1 < 2) + (2 <= 2) + (3 > 2) + (2 >= 3)", 3)
+	testArith("(1 == 1) + (1 != 1)", 1)
+	testArith("6 & 3 | 8 ^ 1", 11)
+	testArith("1 && 2 || 0", 1)
+	testArith("0 && 1 || 0", 0)
+	testArith("0 ? 1 : 2 ? 3 : 4", 3)
+	testArith("1 ? 0 ? 5 : 6 : 7", 6)
+	testArith(strconv.FormatInt(math.MaxInt64, 10)+" + 1", math.MinInt64)
+
+	// variables are read from and assigned to the parameters
+	env.SetParam("x", "5")
+	env.SetParam("neg", " -3 ")
+	env.SetParam("null", "")
+	testArith("x * 2 + neg + null + unset", 7)
+	testArith("y = x + 1", 6)
+	require.Equal(t, "6", env.GetParam("y"))
+	env.SetParam("y", "6")
+	testArith("y *= 2", 12)
+	testArith("a = b = 3", 3)
+	require.Equal(t, "3", env.GetParam("a"))
+	testArith("y -= 2", 10)
+	testArith("y /= 3", 3)
+	testArith("y %= 2", 1)
+	testArith("y <<= 3", 8)
+	testArith("y >>= 1", 4)
+	testArith("y |= 3", 7)
+	testArith("y &= 5", 5)
+	testArith("y ^= 1", 4)
+
+	// the unused operands are not evaluated
+	testArith("0 && (z = 1)", 0)
+	testArith("1 || (z = 1)", 1)
+	testArith("1 ? 2 : (z = 1)", 2)
+	require.Equal(t, "", env.GetParam("z"))
+
+	for _, expression := range []string{"1 / 0", "1 % (x - 5)", "x /= 0", "1 +", "(1", "1 2", "09", "1 ? 2", "$", "2 = 3", "bad"} {
+		env.SetParam("bad", "abc")
+		_, err := evalArith(expression, env)
+		require.True(t, IsExpansionError(err), expression)
+	}
+}
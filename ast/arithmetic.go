@@ -0,0 +1,8 @@
+package ast
+
+// The Arithmetic node represents an arithmetic expansion `$((expression))`. The
+// expression is expanded (parameters and command substitutions) before it is
+// evaluated.
+type Arithmetic struct{ Expr *Expr }
+
+func NewArithmetic(expr *Expr) *Arithmetic { return &Arithmetic{Expr: expr} }
@@ -5,6 +5,7 @@ package ast
 // end of a Command (pipe, binary, etc..)
 type Background struct {
 	Child Node
+	Text  string // The source text of the child, used to describe the job
 }
 
 func NewBackground(child Node) *Background {
@@ -3,3 +3,10 @@ package ast
 type Backtick struct{ Node Node }
 
 func NewBacktick() *Backtick { return &Backtick{Node: nil} }
+
+// The CommandSubstitution node represents a `$(program)` command substitution.
+// It is executed exactly like the Backtick node, and differs only in the syntax
+// (nesting and quoting inside the parentheses do not require escaping).
+type CommandSubstitution struct{ Node Node }
+
+func NewCommandSubstitution() *CommandSubstitution { return &CommandSubstitution{Node: nil} }
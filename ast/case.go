@@ -0,0 +1,33 @@
+package ast
+
+// The Case node represents the case compound command:
+//
+//	case Word in
+//	  Pattern | Pattern) Body ;;
+//	esac
+//
+// The Body of the first item with a pattern that matches Word is executed.
+type Case struct {
+	Word  *Expr
+	Items []*CaseItem
+}
+
+func NewCase(word *Expr) *Case {
+	return &Case{
+		Word:  word,
+		Items: []*CaseItem{},
+	}
+}
+
+// A single item (`pattern1 | pattern2) body ;;`) of a Case node.
+type CaseItem struct {
+	Patterns []*Expr
+	Body     []Node
+}
+
+func NewCaseItem() *CaseItem {
+	return &CaseItem{
+		Patterns: []*Expr{},
+		Body:     []Node{},
+	}
+}
@@ -51,6 +51,8 @@ var (
 	IORedirectionModeInputFd      = IORedirectionMode("<&")
 	IORedirectionModeInputOutput  = IORedirectionMode("<>")
 	IORedirectionModeOutputForce  = IORedirectionMode(">|")
+	IORedirectionModeHereDoc      = IORedirectionMode("<<")
+	IORedirectionModeHereDocStrip = IORedirectionMode("<<-")
 )
 
 type IORedirection struct {
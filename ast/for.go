@@ -0,0 +1,21 @@
+package ast
+
+// The For node represents the for loop compound command:
+//
+//	for Name in Words; do Body; done
+//
+// The Body is executed once for each field produced by the expansion of Words,
+// with the field assigned to the variable Name.
+type For struct {
+	Name  string
+	Words []*Expr // nil when the `in` part is omitted (iterate the positional parameters)
+	Body  []Node
+}
+
+func NewFor(name string) *For {
+	return &For{
+		Name:  name,
+		Words: nil,
+		Body:  []Node{},
+	}
+}
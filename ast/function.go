@@ -0,0 +1,19 @@
+package ast
+
+// The FunctionDefinition node represents the definition of a shell function:
+//
+//	Name() Body
+//
+// The Body is a compound command (possibly wrapped by a Redirect node) that is
+// executed whenever the function is invoked as a simple command.
+type FunctionDefinition struct {
+	Name string
+	Body Node
+}
+
+func NewFunctionDefinition(name string, body Node) *FunctionDefinition {
+	return &FunctionDefinition{
+		Name: name,
+		Body: body,
+	}
+}
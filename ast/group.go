@@ -0,0 +1,26 @@
+package ast
+
+// The BraceGroup node represents a list of commands grouped with braces
+// (`{ a; b; }`). The commands are executed in the current execution environment.
+type BraceGroup struct {
+	Commands []Node
+}
+
+func NewBraceGroup() *BraceGroup {
+	return &BraceGroup{
+		Commands: []Node{},
+	}
+}
+
+// The Subshell node represents a list of commands grouped with parentheses
+// (`( a; b )`). The commands are executed in a copy of the current execution
+// environment, so changes made by them do not affect the current one.
+type Subshell struct {
+	Commands []Node
+}
+
+func NewSubshell() *Subshell {
+	return &Subshell{
+		Commands: []Node{},
+	}
+}
@@ -0,0 +1,21 @@
+package ast
+
+// The If node represents the if compound command:
+//
+//	if Condition; then Then; else Else; fi
+//
+// An elif part is represented as a nested If node which is the only command in
+// the Else list.
+type If struct {
+	Condition []Node // The list whose exit status is tested
+	Then      []Node // Executed when the condition exits with zero
+	Else      []Node // Executed when the condition exits with non-zero (may be empty)
+}
+
+func NewIf() *If {
+	return &If{
+		Condition: []Node{},
+		Then:      []Node{},
+		Else:      []Node{},
+	}
+}
@@ -0,0 +1,38 @@
+package ast
+
+// The operation applied by a parameter expansion (see 2.6.2 Parameter Expansion)
+type ParamOp string
+
+var (
+	ParamOpNone                 = ParamOp("")       // ${p}
+	ParamOpLength               = ParamOp("length") // ${#p}
+	ParamOpDefault              = ParamOp("-")      // ${p-w}
+	ParamOpDefaultNull          = ParamOp(":-")     // ${p:-w}
+	ParamOpAssign               = ParamOp("=")      // ${p=w}
+	ParamOpAssignNull           = ParamOp(":=")     // ${p:=w}
+	ParamOpError                = ParamOp("?")      // ${p?w}
+	ParamOpErrorNull            = ParamOp(":?")     // ${p:?w}
+	ParamOpAlternative          = ParamOp("+")      // ${p+w}
+	ParamOpAlternativeNull      = ParamOp(":+")     // ${p:+w}
+	ParamOpRemoveSmallestSuffix = ParamOp("%")      // ${p%w}
+	ParamOpRemoveLargestSuffix  = ParamOp("%%")     // ${p%%w}
+	ParamOpRemoveSmallestPrefix = ParamOp("#")      // ${p#w}
+	ParamOpRemoveLargestPrefix  = ParamOp("##")     // ${p##w}
+)
+
+// The Param node represents a parameter expansion, like `$x`, `${x}` or
+// `${x:-word}`. The Name is a variable name, a positional parameter (digits) or
+// a special parameter (like @ or ?).
+type Param struct {
+	Name string
+	Op   ParamOp
+	Word *Expr // The word of the operation, nil if the operation has no word
+}
+
+func NewParam(name string) *Param {
+	return &Param{
+		Name: name,
+		Op:   ParamOpNone,
+		Word: nil,
+	}
+}
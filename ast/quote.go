@@ -1,5 +1,22 @@
 package ast
 
+// The SingleQuote node represents a string in single quotes, like `'a $b'`. The
+// value is preserved literally.
+type SingleQuote struct{ Value string }
+
+func NewSingleQuote(value string) *SingleQuote { return &SingleQuote{Value: value} }
+
+// The DoubleQuote node represents a string in double quotes, like `"a $b"`. The
+// expansions inside the quotes are executed, but their results are not split
+// into fields or used as patterns.
 type DoubleQuote struct{ Nodes []Node }
 
-func NewDoubleQuote() *DoubleQuote { return &DoubleQuote{Nodes: []Node{}} }
+func NewDoubleQuote(nodes ...Node) *DoubleQuote {
+	return &DoubleQuote{Nodes: append([]Node{}, nodes...)}
+}
+
+// The Escaped node represents a character quoted by a backslash, like `\$`. The
+// value is the character without the backslash.
+type Escaped struct{ Value string }
+
+func NewEscaped(value string) *Escaped { return &Escaped{Value: value} }
@@ -0,0 +1,16 @@
+package ast
+
+// The Redirect node states that the IO redirections should be applied to the
+// execution of the child AST. It is generated for compound commands that are
+// followed by redirections, like `{ a; b; } > out`
+type Redirect struct {
+	Child     Node
+	Redirects []*IORedirection
+}
+
+func NewRedirect(child Node) *Redirect {
+	return &Redirect{
+		Child:     child,
+		Redirects: []*IORedirection{},
+	}
+}
@@ -0,0 +1,7 @@
+package ast
+
+// The Tilde node represents a tilde-prefix (see 2.6.1 Tilde Expansion), like `~`
+// or `~user`. The User is empty for the home directory of the current user.
+type Tilde struct{ User string }
+
+func NewTilde(user string) *Tilde { return &Tilde{User: user} }
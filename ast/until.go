@@ -0,0 +1,18 @@
+package ast
+
+// The Until node represents the until loop compound command:
+//
+//	until Condition; do Body; done
+//
+// The Body is executed as long as the Condition exits with non-zero.
+type Until struct {
+	Condition []Node
+	Body      []Node
+}
+
+func NewUntil() *Until {
+	return &Until{
+		Condition: []Node{},
+		Body:      []Node{},
+	}
+}
@@ -0,0 +1,18 @@
+package ast
+
+// The While node represents the while loop compound command:
+//
+//	while Condition; do Body; done
+//
+// The Body is executed as long as the Condition exits with zero.
+type While struct {
+	Condition []Node
+	Body      []Node
+}
+
+func NewWhile() *While {
+	return &While{
+		Condition: []Node{},
+		Body:      []Node{},
+	}
+}
@@ -2,19 +2,67 @@ package gobash
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/omerhorev/gobash/ast"
 	"github.com/omerhorev/gobash/command"
 )
 
+// flowCommand is a command that can alter the control flow of the executor
+// (like break and continue). Instead of only an exit status, it returns an error
+// that is propagated up the AST.
+type flowCommand interface {
+	command.Command
+
+	ExecuteFlow([]string, *command.Env) (int, error)
+}
+
+// The special built-ins. They are found before any other command
+func (e *Executor) specialBuiltins(env *ExecEnv) []command.Command {
+	return []command.Command{
+		&loopControlBuiltinCommand{Name: "break", Continue: false},
+		&loopControlBuiltinCommand{Name: "continue", Continue: true},
+		&returnBuiltinCommand{env: env},
+		&exitBuiltinCommand{env: env},
+		&exportBuiltinCommand{env: env},
+		&readonlyBuiltinCommand{env: env},
+		&unsetBuiltinCommand{env: env},
+		&setBuiltinCommand{env: env},
+		&execBuiltinCommand{Executor: e, env: env},
+	}
+}
+
+// Returns whether the command name is the exec special built-in. Without a
+// command, the redirections of exec affect the current environment.
+func (e *Executor) isExec(name string) bool {
+	return name == "exec" && !e.Settings.NoExec
+}
+
+// Returns whether the command name is a special built-in. Variable assignments
+// that precede a special built-in affect the current environment.
+func (e *Executor) isSpecialBuiltin(name string, env *ExecEnv) bool {
+	for _, command := range e.specialBuiltins(env) {
+		if command.Match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type cdBuiltinCommand struct {
 	*Executor
+	env *ExecEnv
 }
 
 func (c *cdBuiltinCommand) Match(word string) bool { return word == "cd" && !c.Executor.Settings.NoCd }
 func (c *cdBuiltinCommand) Execute(args []string, env *command.Env) int {
 	path := "/"
 	if len(args) == 1 {
-		if val := c.Executor.ExecEnv.GetParam("HOME"); val != "" {
+		if val := c.env.GetParam("HOME"); val != "" {
 			path = val
 		} else {
 			env.Error(errors.New("HOME not set"))
@@ -27,10 +75,865 @@ func (c *cdBuiltinCommand) Execute(args []string, env *command.Env) int {
 		return 1
 	}
 
-	if err := c.Executor.Cd(path); err != nil {
+	if err := c.Executor.cd(path, c.env); err != nil {
 		env.Error(err)
 		return 1
 	}
 
 	return 0
 }
+
+// The alias built-ins. They operate on the alias table of the environment
+func (e *Executor) aliasBuiltins(env *ExecEnv) []command.Command {
+	return []command.Command{
+		&aliasBuiltinCommand{env: env},
+		&unaliasBuiltinCommand{env: env},
+	}
+}
+
+// The alias built-in. Defines the aliases provided with a value, and writes the
+// definitions of the others. Without arguments, writes the definitions of all
+// the aliases. The definitions are written in a format that can be reinput to
+// the shell.
+//
+//	alias [alias-name[=string]...]
+type aliasBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *aliasBuiltinCommand) Match(word string) bool { return word == "alias" }
+func (c *aliasBuiltinCommand) Execute(args []string, env *command.Env) int {
+	if len(args) == 1 {
+		names := []string{}
+		for name := range c.env.Aliases {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			env.Printf("%s=%s\n", name, shellQuote(c.env.Aliases[name]))
+		}
+
+		return 0
+	}
+
+	ret := 0
+	for _, arg := range args[1:] {
+		if i := strings.IndexRune(arg, '='); i > 0 {
+			c.env.Aliases[arg[:i]] = arg[i+1:]
+		} else if value, exists := c.env.Aliases[arg]; exists {
+			env.Printf("%s=%s\n", arg, shellQuote(value))
+		} else {
+			env.Error(fmt.Errorf("%s: not found", arg))
+			ret = 1
+		}
+	}
+
+	return ret
+}
+
+// The unalias built-in. Removes the aliases provided, or all the aliases with -a.
+//
+//	unalias alias-name...
+//	unalias -a
+type unaliasBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *unaliasBuiltinCommand) Match(word string) bool { return word == "unalias" }
+func (c *unaliasBuiltinCommand) Execute(args []string, env *command.Env) int {
+	if len(args) == 2 && args[1] == "-a" {
+		for name := range c.env.Aliases {
+			delete(c.env.Aliases, name)
+		}
+
+		return 0
+	}
+
+	if len(args) == 1 {
+		env.Error(errors.New("usage: unalias [-a] name [name ...]"))
+		return 2
+	}
+
+	ret := 0
+	for _, name := range args[1:] {
+		if _, exists := c.env.Aliases[name]; !exists {
+			env.Error(fmt.Errorf("%s: not found", name))
+			ret = 1
+			continue
+		}
+
+		delete(c.env.Aliases, name)
+	}
+
+	return ret
+}
+
+// Quotes the string so it is read back as a single word by the shell. Strings
+// that contain only safe characters are not quoted.
+func shellQuote(str string) string {
+	if str == "" {
+		return "''"
+	}
+
+	safe := true
+	for _, r := range str {
+		if !isNameRune(r) && !strings.ContainsRune("@%+=:,./-", r) {
+			safe = false
+			break
+		}
+	}
+
+	if safe {
+		return str
+	}
+
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// The job control built-ins. They operate on the job table of the executor
+func (e *Executor) jobControlBuiltins() []command.Command {
+	return []command.Command{
+		&waitBuiltinCommand{Executor: e},
+		&jobsBuiltinCommand{Executor: e},
+		&fgBuiltinCommand{Executor: e},
+		&bgBuiltinCommand{Executor: e},
+		&killBuiltinCommand{Executor: e},
+	}
+}
+
+// The wait built-in. Waits for the jobs provided, or for all the known jobs if
+// none is provided. Jobs are identified by a process ID or a job ID (like %1).
+//
+//	wait [job...]
+type waitBuiltinCommand struct {
+	*Executor
+}
+
+func (c *waitBuiltinCommand) Match(word string) bool { return word == "wait" }
+func (c *waitBuiltinCommand) Execute(args []string, env *command.Env) int {
+	if len(args) == 1 {
+		for _, j := range c.Executor.jobs.all() {
+			j.Wait()
+			c.Executor.jobs.remove(j)
+		}
+
+		return 0
+	}
+
+	ret := 0
+	for _, arg := range args[1:] {
+		j, err := c.Executor.jobs.find(arg)
+		if err != nil {
+			// unknown processes are assumed to be terminated with 127
+			env.Error(err)
+			ret = 127
+			continue
+		}
+
+		ret = j.Wait()
+		c.Executor.jobs.remove(j)
+	}
+
+	return ret
+}
+
+// The jobs built-in. Reports the jobs provided, or all the known jobs if none is
+// provided. Jobs that are reported as done are forgotten.
+//
+//	jobs [-l|-p] [job...]
+type jobsBuiltinCommand struct {
+	*Executor
+}
+
+func (c *jobsBuiltinCommand) Match(word string) bool { return word == "jobs" }
+func (c *jobsBuiltinCommand) Execute(args []string, env *command.Env) int {
+	long, pidOnly := false, false
+
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		option := args[0]
+		args = args[1:]
+
+		if option == "--" {
+			break
+		}
+
+		switch option {
+		case "-l":
+			long = true
+		case "-p":
+			pidOnly = true
+		default:
+			env.Error(fmt.Errorf("%s: invalid option", option))
+			return 2
+		}
+	}
+
+	all := c.Executor.jobs.all()
+
+	jobs := all
+	if len(args) > 0 {
+		jobs = []*Job{}
+		for _, arg := range args {
+			j, err := c.Executor.jobs.find(arg)
+			if err != nil {
+				env.Error(err)
+				return 1
+			}
+
+			jobs = append(jobs, j)
+		}
+	}
+
+	for _, j := range jobs {
+		if pidOnly {
+			env.Printf("%d\n", j.Pid)
+			continue
+		}
+
+		// the current job is the last one started, the previous job is the one
+		// before it
+		current := ' '
+		if j == all[len(all)-1] {
+			current = '+'
+		} else if len(all) > 1 && j == all[len(all)-2] {
+			current = '-'
+		}
+
+		done := j.Done()
+		if long {
+			env.Printf("[%d] %c %d %s %s\n", j.Id, current, j.Pid, j.state(), j.Text)
+		} else {
+			env.Printf("[%d] %c %s %s\n", j.Id, current, j.state(), j.Text)
+		}
+
+		if done {
+			c.Executor.jobs.remove(j)
+		}
+	}
+
+	return 0
+}
+
+// The fg built-in. Jobs are not backed by real processes, so moving a job to
+// the foreground means waiting for it.
+//
+//	fg [job]
+type fgBuiltinCommand struct {
+	*Executor
+}
+
+func (c *fgBuiltinCommand) Match(word string) bool { return word == "fg" }
+func (c *fgBuiltinCommand) Execute(args []string, env *command.Env) int {
+	spec := "%"
+	if len(args) == 2 {
+		spec = args[1]
+	} else if len(args) > 2 {
+		env.Error(errors.New("too many arguments"))
+		return 1
+	}
+
+	j, err := c.Executor.jobs.find(spec)
+	if err != nil {
+		env.Error(err)
+		return 1
+	}
+
+	env.Println(j.Text)
+
+	ret := j.Wait()
+	c.Executor.jobs.remove(j)
+
+	return ret
+}
+
+// The bg built-in. Jobs are not backed by real processes and cannot be stopped,
+// so jobs are always running in the background.
+//
+//	bg [job...]
+type bgBuiltinCommand struct {
+	*Executor
+}
+
+func (c *bgBuiltinCommand) Match(word string) bool { return word == "bg" }
+func (c *bgBuiltinCommand) Execute(args []string, env *command.Env) int {
+	specs := args[1:]
+	if len(specs) == 0 {
+		specs = []string{"%"}
+	}
+
+	ret := 0
+	for _, spec := range specs {
+		j, err := c.Executor.jobs.find(spec)
+		if err != nil {
+			env.Error(err)
+			ret = 1
+			continue
+		}
+
+		if j.Done() {
+			env.Error(fmt.Errorf("job %d has terminated", j.Id))
+			ret = 1
+			continue
+		}
+
+		env.Error(fmt.Errorf("job %d already in background", j.Id))
+	}
+
+	return ret
+}
+
+// The kill built-in. Sends a signal (TERM by default) to jobs, which cancels
+// their execution.
+//
+//	kill [-s signal_name] job...
+//	kill -signal_name job...
+//	kill -signal_number job...
+//	kill -l [exit_status]
+type killBuiltinCommand struct {
+	*Executor
+}
+
+func (c *killBuiltinCommand) Match(word string) bool { return word == "kill" }
+func (c *killBuiltinCommand) Execute(args []string, env *command.Env) int {
+	args = args[1:]
+	signal := SignalTERM
+
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		var sig string
+		switch args[0] {
+		case "-l":
+			return c.list(args[1:], env)
+		case "-s":
+			if len(args) < 2 {
+				env.Error(errors.New("-s: option requires an argument"))
+				return 2
+			}
+
+			sig, args = args[1], args[2:]
+		case "--":
+			args = args[1:]
+		default:
+			sig, args = args[0][1:], args[1:]
+		}
+
+		if sig != "" {
+			n, ok := parseSignal(sig)
+			if !ok {
+				env.Error(fmt.Errorf("%s: invalid signal specification", sig))
+				return 1
+			}
+
+			signal = n
+		}
+	}
+
+	if len(args) == 0 {
+		env.Error(errors.New("usage: kill [-s sigspec | -signum | -sigspec] pid | jobspec ... or kill -l [sigspec]"))
+		return 2
+	}
+
+	ret := 0
+	for _, arg := range args {
+		j, err := c.Executor.jobs.find(arg)
+		if err != nil {
+			env.Error(err)
+			ret = 1
+			continue
+		}
+
+		// signal 0 only checks that the job exists
+		if signal != 0 {
+			j.Kill(signal)
+		}
+	}
+
+	return ret
+}
+
+// Lists the signal names, or the names of the signals that terminated commands
+// with the exit statuses provided
+func (c *killBuiltinCommand) list(args []string, env *command.Env) int {
+	if len(args) == 0 {
+		names := []string{}
+		for _, s := range signals {
+			names = append(names, s.Name)
+		}
+
+		env.Println(strings.Join(names, " "))
+		return 0
+	}
+
+	ret := 0
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			env.Error(fmt.Errorf("%s: invalid exit status", arg))
+			ret = 1
+			continue
+		}
+
+		if n > 128 {
+			n -= 128
+		}
+
+		name, ok := signalName(n)
+		if !ok {
+			env.Error(fmt.Errorf("%s: invalid signal specification", arg))
+			ret = 1
+			continue
+		}
+
+		env.Println(name)
+	}
+
+	return ret
+}
+
+// The break and continue special built-ins
+//
+//	break [n]
+//	continue [n]
+type loopControlBuiltinCommand struct {
+	Name     string
+	Continue bool
+}
+
+func (c *loopControlBuiltinCommand) Match(word string) bool { return word == c.Name }
+func (c *loopControlBuiltinCommand) Execute(args []string, env *command.Env) int {
+	ret, _ := c.ExecuteFlow(args, env)
+	return ret
+}
+
+func (c *loopControlBuiltinCommand) ExecuteFlow(args []string, env *command.Env) (int, error) {
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			env.Error(fmt.Errorf("%s: loop count out of range", args[1]))
+			return 1, nil
+		}
+
+		count = n
+	} else if len(args) > 2 {
+		env.Error(errors.New("too many arguments"))
+		return 1, nil
+	}
+
+	return 0, loopControlError{Continue: c.Continue, Count: count}
+}
+
+// The return special built-in. Without n, the exit status is the exit status of
+// the last command executed.
+//
+//	return [n]
+type returnBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *returnBuiltinCommand) Match(word string) bool { return word == "return" }
+func (c *returnBuiltinCommand) Execute(args []string, env *command.Env) int {
+	ret, _ := c.ExecuteFlow(args, env)
+	return ret
+}
+
+func (c *returnBuiltinCommand) ExecuteFlow(args []string, env *command.Env) (int, error) {
+	status := c.env.Status
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 255 {
+			env.Error(fmt.Errorf("%s: numeric argument required", args[1]))
+			return 1, nil
+		}
+
+		status = n
+	} else if len(args) > 2 {
+		env.Error(errors.New("too many arguments"))
+		return 1, nil
+	}
+
+	return status, returnError{Status: status}
+}
+
+// The exit special built-in. Exits the shell, or only the subshell environment it
+// is executed in. Without n, the exit status is the exit status of the last
+// command executed.
+//
+//	exit [n]
+type exitBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *exitBuiltinCommand) Match(word string) bool { return word == "exit" }
+func (c *exitBuiltinCommand) Execute(args []string, env *command.Env) int {
+	ret, _ := c.ExecuteFlow(args, env)
+	return ret
+}
+
+func (c *exitBuiltinCommand) ExecuteFlow(args []string, env *command.Env) (int, error) {
+	status := c.env.Status
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 255 {
+			env.Error(fmt.Errorf("%s: numeric argument required", args[1]))
+			return 2, ExitError{Status: 2}
+		}
+
+		status = n
+	} else if len(args) > 2 {
+		env.Error(errors.New("too many arguments"))
+		return 1, nil
+	}
+
+	return status, ExitError{Status: status}
+}
+
+// The export special built-in. Exports the variables provided to the
+// environment of the commands, and assigns them if a value is provided. With -p
+// or without arguments, writes the exported variables in a format that can be
+// reinput to the shell.
+//
+//	export name[=word]...
+//	export -p
+type exportBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *exportBuiltinCommand) Match(word string) bool { return word == "export" }
+func (c *exportBuiltinCommand) Execute(args []string, env *command.Env) int {
+	return setAttribute(args, c.env, c.env.Exported, env)
+}
+
+// The readonly special built-in. Makes the variables provided read-only, and
+// assigns them if a value is provided. With -p or without arguments, writes the
+// read-only variables in a format that can be reinput to the shell.
+//
+//	readonly name[=word]...
+//	readonly -p
+type readonlyBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *readonlyBuiltinCommand) Match(word string) bool { return word == "readonly" }
+func (c *readonlyBuiltinCommand) Execute(args []string, env *command.Env) int {
+	return setAttribute(args, c.env, c.env.ReadOnly, env)
+}
+
+// Sets the attribute (exported or read-only) of the variables provided, for the
+// export and readonly special built-ins
+func setAttribute(args []string, execEnv *ExecEnv, attribute map[string]bool, env *command.Env) int {
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 || (len(args) == 1 && args[0] == "-p") {
+		names := []string{}
+		for name := range attribute {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			if value, set := execEnv.Params[name]; set {
+				env.Printf("%s %s=%s\n", env.Name(), name, shellQuote(value))
+			} else {
+				env.Printf("%s %s\n", env.Name(), name)
+			}
+		}
+
+		return 0
+	}
+
+	ret := 0
+	for _, arg := range args {
+		name, value, assign := strings.Cut(arg, "=")
+		if !isName(name) {
+			env.Error(fmt.Errorf("%s: not a valid identifier", arg))
+			ret = 1
+			continue
+		}
+
+		if assign {
+			if err := execEnv.Assign(name, value); err != nil {
+				env.Error(err)
+				ret = 1
+				continue
+			}
+		}
+
+		attribute[name] = true
+	}
+
+	return ret
+}
+
+// The unset special built-in. Unsets the variables (or with -f, the functions)
+// provided. Read-only variables cannot be unset.
+//
+//	unset [-v] name...
+//	unset -f name...
+type unsetBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *unsetBuiltinCommand) Match(word string) bool { return word == "unset" }
+func (c *unsetBuiltinCommand) Execute(args []string, env *command.Env) int {
+	functions := false
+
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		option := args[0]
+		args = args[1:]
+
+		if option == "--" {
+			break
+		}
+
+		switch option {
+		case "-f":
+			functions = true
+		case "-v":
+			functions = false
+		default:
+			env.Error(fmt.Errorf("%s: invalid option", option))
+			return 2
+		}
+	}
+
+	ret := 0
+	for _, name := range args {
+		if functions {
+			delete(c.env.Functions, name)
+			continue
+		}
+
+		if err := c.env.Unset(name); err != nil {
+			env.Error(err)
+			ret = 1
+		}
+	}
+
+	return ret
+}
+
+// The set special built-in. Enables (-) or disables (+) the options of the shell
+// by their flags or names, and sets the positional parameters to the remaining
+// arguments. Without arguments, writes the variables in a format that can be
+// reinput to the shell. -o and +o without a name write the current options.
+// The options belong to the environment, so the options set in a subshell
+// environment do not affect the shell.
+//
+//	set [-+Cefnuvx] [-+o name]... [--] [arg...]
+//	set -o
+//	set +o
+type setBuiltinCommand struct {
+	env *ExecEnv
+}
+
+func (c *setBuiltinCommand) Match(word string) bool { return word == "set" }
+func (c *setBuiltinCommand) Execute(args []string, env *command.Env) int {
+	args = args[1:]
+	if len(args) == 0 {
+		names := []string{}
+		for name := range c.env.Params {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			env.Printf("%s=%s\n", name, shellQuote(c.env.Params[name]))
+		}
+
+		return 0
+	}
+
+	for len(args) > 0 {
+		arg := args[0]
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+
+		args = args[1:]
+		if arg == "--" {
+			c.env.PositionalParams = append([]string{}, args...)
+			return 0
+		}
+
+		value := arg[0] == '-'
+		for _, flag := range arg[1:] {
+			if flag != 'o' {
+				if err := c.env.Options.SetFlag(flag, value); err != nil {
+					env.Error(err)
+					return 2
+				}
+
+				continue
+			}
+
+			if len(args) == 0 {
+				c.printOptions(value, env)
+				continue
+			}
+
+			if err := c.env.Options.SetName(args[0], value); err != nil {
+				env.Error(err)
+				return 2
+			}
+
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 {
+		c.env.PositionalParams = append([]string{}, args...)
+	}
+
+	return 0
+}
+
+// Writes the current options, as a table (set -o) or in a format that can be
+// reinput to the shell (set +o)
+func (c *setBuiltinCommand) printOptions(table bool, env *command.Env) {
+	for _, opt := range options {
+		if opt.Name == "" {
+			continue
+		}
+
+		value := *opt.Value(&c.env.Options)
+		if table {
+			state := "off"
+			if value {
+				state = "on"
+			}
+
+			env.Printf("%-16s%s\n", opt.Name, state)
+		} else {
+			sign := "+"
+			if value {
+				sign = "-"
+			}
+
+			env.Printf("set %so %s\n", sign, opt.Name)
+		}
+	}
+}
+
+// The exec special built-in. Executes the command provided instead of the shell,
+// so the shell exits with the exit status of the command. Without a command,
+// the redirections of exec are not restored and affect the current environment
+// (like `exec 2>&1` or `exec 3<&-`).
+//
+//	exec [command [argument...]]
+type execBuiltinCommand struct {
+	*Executor
+	env *ExecEnv
+}
+
+func (c *execBuiltinCommand) Match(word string) bool { return c.isExec(word) }
+func (c *execBuiltinCommand) Execute(args []string, env *command.Env) int {
+	ret, _ := c.ExecuteFlow(args, env)
+	return ret
+}
+
+func (c *execBuiltinCommand) ExecuteFlow(args []string, env *command.Env) (int, error) {
+	args = args[1:]
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	cmd, err := c.getCommand(args[0], c.env)
+	if err != nil {
+		env.Error(err)
+
+		// an interactive shell does not exit when the command is not found
+		if c.env.Options.Interactive {
+			return retErr, nil
+		}
+
+		return retErr, ExitError{Status: retErr}
+	}
+
+	env.Args = args
+
+	status := 0
+	if flowCmd, ok := cmd.(flowCommand); ok {
+		if status, err = flowCmd.ExecuteFlow(args, env); err != nil {
+			return status, err
+		}
+	} else {
+		status = cmd.Execute(args, env)
+	}
+
+	return status, ExitError{Status: status}
+}
+
+// A shell function invocation. The function body is executed in the environment
+// the function was invoked from, with the positional parameters set to the
+// arguments of the invocation.
+type functionCommand struct {
+	*Executor
+	env      *ExecEnv
+	Function *ast.FunctionDefinition
+}
+
+func (c *functionCommand) Match(word string) bool { return word == c.Function.Name }
+func (c *functionCommand) Execute(args []string, env *command.Env) int {
+	ret, _ := c.ExecuteFlow(args, env)
+	return ret
+}
+
+func (c *functionCommand) ExecuteFlow(args []string, env *command.Env) (int, error) {
+	// variable assignments that precede the invocation are in effect (and
+	// exported) only during the execution of the function
+	saved := map[string]*string{}
+	exported := []string{}
+	for k, v := range env.Env {
+		if !c.env.Exported[k] {
+			c.env.Exported[k] = true
+			exported = append(exported, k)
+		}
+
+		if old, exists := c.env.Params[k]; !exists {
+			saved[k] = nil
+		} else if old != v {
+			saved[k] = &old
+		} else {
+			continue
+		}
+
+		c.env.Params[k] = v
+	}
+
+	positionalParams := c.env.PositionalParams
+	c.env.PositionalParams = append([]string{}, args[1:]...)
+
+	defer func() {
+		c.env.PositionalParams = positionalParams
+
+		for _, k := range exported {
+			delete(c.env.Exported, k)
+		}
+
+		for k, v := range saved {
+			if v == nil {
+				delete(c.env.Params, k)
+			} else {
+				c.env.Params[k] = *v
+			}
+		}
+	}()
+
+	ret, err := c.Executor.executeNode(c.Function.Body, c.env)
+
+	var r returnError
+	if errors.As(err, &r) {
+		return r.Status, nil
+	}
+
+	return ret, err
+}
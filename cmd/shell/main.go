@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/omerhorev/gobash"
@@ -8,14 +11,61 @@ import (
 )
 
 func main() {
-	s := gobash.NewShell(gobash.InteractiveDefaultSettings)
+	os.Exit(run())
+}
+
+// Runs the shell and returns its exit status. The exit status is returned rather
+// than exiting here, so the deferred calls are executed.
+func run() int {
+	settings := gobash.InteractiveDefaultSettings
+
+	// a script file can be provided with its arguments
+	var script *os.File
+	if len(os.Args) > 1 {
+		f, err := os.Open(os.Args[1])
+		if err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+
+			fmt.Fprintf(os.Stderr, "gobash: %s: %v\n", os.Args[1], err)
+			return 127
+		}
+		defer f.Close()
+
+		script = f
+		settings.Interactive = false
+	}
+
+	s := gobash.NewShell(settings)
 	s.SetStdin(os.Stdin)
 	s.SetStdout(os.Stdout)
 	s.SetStderr(os.Stderr)
 
 	s.AddCommands(command.Default...)
 
-	if err := s.RunInteractive(); err != nil {
-		panic(err)
+	var err error
+	if script != nil {
+		err = s.RunScriptArgs(script, os.Args[1:])
+	} else {
+		err = s.RunInteractive()
 	}
+
+	// the shell exits with the exit status of the last command, or the one it
+	// exited with (like with the exit special built-in)
+	if err == nil || gobash.IsExitError(err) {
+		return s.ExitStatus()
+	}
+
+	// the errors of the commands were already reported by the shell
+	if !gobash.IsReportedError(err) {
+		fmt.Fprintf(os.Stderr, "gobash: %v\n", err)
+	}
+
+	if errors.Is(err, gobash.SyntaxError{}) {
+		return 2
+	}
+
+	return 1
 }
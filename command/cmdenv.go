@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -30,6 +31,10 @@ type Env struct {
 
 	// The arguments that will be passed to the command (like os.Args)
 	Args []string
+
+	// Canceled when the command should stop its execution, for example when the
+	// job it is executed in is killed. Long running commands should watch Done.
+	Context context.Context
 }
 
 // Returns the file with the fd provided or io.ErrClosed
@@ -41,6 +46,16 @@ func (e *Env) GetFile(fd int) (io.ReadWriter, error) {
 	}
 }
 
+// Returns a channel that is closed when the command should stop its execution
+// (see Context). If there is no context, the channel is never closed.
+func (e *Env) Done() <-chan struct{} {
+	if e.Context == nil {
+		return nil
+	}
+
+	return e.Context.Done()
+}
+
 // Returns the stdin file
 func (e *Env) Stdin() io.Reader {
 	if file, err := e.GetFile(fdStdin); err != nil {
@@ -106,5 +121,5 @@ func (e *Env) Name() string {
 //
 //	rev: cannot open /tmp/fil1: No such file or directory
 func (e *Env) Error(err error) {
-	fmt.Fprintf(e.Stderr(), "%s: %s", e.Name(), err.Error())
+	fmt.Fprintf(e.Stderr(), "%s: %s\n", e.Name(), err.Error())
 }
@@ -30,8 +30,11 @@ var Sleep = &SimpleMatchCommand{
 			}
 		}
 
-		time.Sleep(duration)
-
-		return 0
+		select {
+		case <-time.After(duration):
+			return 0
+		case <-e.Done():
+			return 1
+		}
 	},
 }
@@ -1,15 +1,35 @@
 package gobash
 
-import "os"
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+)
 
-func defaultCdFunc(p string) (string, error) {
-	if err := os.Chdir(p); err != nil {
+// Returns the directory p, relative to the working directory wd. The working
+// directory of the process is not changed, so subshells and jobs can have their
+// own working directory.
+func defaultCdFunc(wd string, p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(wd, p)
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", &os.PathError{Op: "chdir", Path: p, Err: syscall.ENOTDIR}
+	}
+
+	return filepath.Clean(p), nil
+}
+
+func defaultHomeDirFunc(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
 		return "", err
-	} else {
-		if dir, err := os.Getwd(); err != nil {
-			return p, err
-		} else {
-			return dir, nil
-		}
 	}
+
+	return u.HomeDir, nil
 }
@@ -55,6 +55,58 @@ func (err IoRedirectionError) Is(err2 error) bool {
 	return ok
 }
 
+type ExpansionError struct{ Err error }
+
+func IsExpansionError(err error) bool {
+	return errors.Is(err, ExpansionError{})
+}
+
+func newExpansionError(err error) ExpansionError {
+	return ExpansionError{
+		Err: err,
+	}
+}
+
+func (err ExpansionError) Error() (description string) {
+	return err.Err.Error()
+}
+
+func (err ExpansionError) Unwrap() error {
+	return err.Err
+}
+
+func (err ExpansionError) Is(err2 error) bool {
+	_, ok := err2.(ExpansionError)
+	return ok
+}
+
+// AssignmentError is raised when a variable cannot be assigned, like when it is
+// read-only
+type AssignmentError struct{ Err error }
+
+func IsAssignmentError(err error) bool {
+	return errors.Is(err, AssignmentError{})
+}
+
+func newAssignmentError(err error) AssignmentError {
+	return AssignmentError{
+		Err: err,
+	}
+}
+
+func (err AssignmentError) Error() (description string) {
+	return err.Err.Error()
+}
+
+func (err AssignmentError) Unwrap() error {
+	return err.Err
+}
+
+func (err AssignmentError) Is(err2 error) bool {
+	_, ok := err2.(AssignmentError)
+	return ok
+}
+
 type UnknownCommandError struct{ Command string }
 
 func IsUnknownCommandError(err error) bool {
@@ -75,3 +127,108 @@ func (err UnknownCommandError) Is(err2 error) bool {
 	_, ok := err2.(UnknownCommandError)
 	return ok
 }
+
+// reportedError wraps an error that was already written to the shell's stderr
+// while it propagates up the AST.
+type reportedError struct{ Err error }
+
+// Returns whether the error was already written to the shell's stderr by the
+// executor, so it should not be reported again
+func IsReportedError(err error) bool {
+	return errors.Is(err, reportedError{})
+}
+
+func newReportedError(err error) reportedError {
+	return reportedError{
+		Err: err,
+	}
+}
+
+func (err reportedError) Error() string {
+	return err.Err.Error()
+}
+
+func (err reportedError) Unwrap() error {
+	return err.Err
+}
+
+func (err reportedError) Is(err2 error) bool {
+	_, ok := err2.(reportedError)
+	return ok
+}
+
+// loopControlError is raised by the break and continue special built-ins. It
+// unwinds the execution up to the enclosing loop.
+type loopControlError struct {
+	Continue bool // whether to continue the loop instead of exiting it
+	Count    int  // the number of enclosing loops to unwind
+}
+
+func isLoopControlError(err error) bool {
+	return errors.Is(err, loopControlError{})
+}
+
+// loop control is not an actual error, nothing should be reported
+func (err loopControlError) Error() string {
+	return ""
+}
+
+func (err loopControlError) Is(err2 error) bool {
+	_, ok := err2.(loopControlError)
+	return ok
+}
+
+// returnError is raised by the return special built-in. It unwinds the execution
+// up to the function being executed.
+type returnError struct {
+	Status int // the exit status of the function
+}
+
+// return is not an actual error, nothing should be reported
+func (err returnError) Error() string {
+	return ""
+}
+
+// ExitError is raised when the shell exits, by the exit special built-in or when
+// a command fails with errexit (set -e). It unwinds the execution, and it is
+// returned by Run with the exit status of the shell.
+type ExitError struct {
+	Status int // the exit status of the shell
+}
+
+func IsExitError(err error) bool {
+	return errors.Is(err, ExitError{})
+}
+
+func (err ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", err.Status)
+}
+
+func (err ExitError) Is(err2 error) bool {
+	_, ok := err2.(ExitError)
+	return ok
+}
+
+// Returns the exit status of the shell if the error is an ExitError
+func exitStatus(err error) (int, bool) {
+	var exit ExitError
+	if errors.As(err, &exit) {
+		return exit.Status, true
+	}
+
+	return 0, false
+}
+
+// canceledError is raised when the context of the execution environment is
+// canceled (like when a job is killed). It unwinds the execution.
+type canceledError struct{}
+
+// cancellation is not an actual error, nothing should be reported
+func (err canceledError) Error() string {
+	return ""
+}
+
+func (err canceledError) Is(err2 error) bool {
+	_, ok := err2.(canceledError)
+	return ok
+}
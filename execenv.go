@@ -1,20 +1,24 @@
 package gobash
 
 import (
+	"context"
+	"fmt"
 	"io"
 
+	"github.com/omerhorev/gobash/ast"
 	"github.com/omerhorev/gobash/utils"
 )
 
 // Execution environment contains all the parameters of the current
 // execution:
 //   - Working directory
-//   - Shell parameters
+//   - Shell parameters (and whether they are exported or read-only)
 //   - Aliases
 //   - Shell functions
 //   - Open Files (std in/out/err)
 type ExecEnv struct {
-	// Working directory as set by cd
+	// Working directory as set by cd. With the os file system, it starts as the
+	// working directory of the process.
 	WorkingDirectory string
 
 	// Shell parameters that set by variable assignment (`set` command) or from the
@@ -22,18 +26,79 @@ type ExecEnv struct {
 	// when it begins (`export` special built-in).
 	Params map[string]string
 
-	// functions
+	// The names of the shell variables that are exported to the environment of
+	// the commands (`export` special built-in). An exported variable that is not
+	// set is exported once it is assigned.
+	Exported map[string]bool
+
+	// The names of the shell variables that cannot be assigned or unset
+	// (`readonly` special built-in)
+	ReadOnly map[string]bool
+
+	// The positional parameters ($1, $2, ...), set when the shell or a function is
+	// invoked with arguments.
+	PositionalParams []string
+
+	// The name of the shell or the shell script ($0)
+	ShellName string
+
+	// The exit status of the last command ($?)
+	Status int
+
+	// Aliases defined by the alias built-in, by name. The value of an alias is
+	// substituted for its name when it is the command word (see 2.3.1 Alias
+	// Substitution).
+	Aliases map[string]string
+
+	// Shell functions defined by function definition commands (`f() { ...; }`),
+	// by name.
+	Functions map[string]*ast.FunctionDefinition
 
 	// Open files that can be used by the process (like stdin[0], stdout[1] and
 	// stderr[2]). Just like a file with fd, it can be read from and written to.
 	Files map[int]io.ReadWriteCloser
+
+	// The options of the shell, as changed by the set special built-in. Subshell
+	// environments have a copy of the options, so they do not affect the shell.
+	Options Options
+
+	// Canceled when the execution should stop, for example when the job that
+	// is executed in this environment is killed.
+	Context context.Context
+
+	// The exit status of the last command substitution, which is the exit status
+	// of a command without a command name (like `x=$(cmd)`)
+	substitutionStatus int
+
+	// Greater than zero while executing a command whose failure does not exit
+	// the shell with errexit (set -e), like the condition of an if command
+	errExitIgnored int
+
+	// Set while PS4 is expanded, so the commands executed by the expansion are
+	// not traced with xtrace (set -x)
+	tracing bool
+
+	// The files opened by the shell for the file descriptors of this environment
+	// for good (like `exec 3>file`), by fd. Duplicated file descriptors refer to
+	// the same file. Subshell environments do not own the files of their parent.
+	openedFiles map[int]*openedFile
 }
 
+// A file opened by the shell, closed once no file descriptor refers to it
+type openedFile struct{ io.Closer }
+
 func newExecEnv() *ExecEnv {
 	return &ExecEnv{
 		WorkingDirectory: "/",
 		Params:           map[string]string{},
+		Exported:         map[string]bool{},
+		ReadOnly:         map[string]bool{},
+		PositionalParams: []string{},
+		Aliases:          map[string]string{},
+		Functions:        map[string]*ast.FunctionDefinition{},
 		Files:            map[int]io.ReadWriteCloser{},
+		Context:          context.Background(),
+		openedFiles:      map[int]*openedFile{},
 	}
 }
 
@@ -72,13 +137,41 @@ func (e *ExecEnv) New() *ExecEnv {
 	commandExecEnv := &ExecEnv{
 		WorkingDirectory: e.WorkingDirectory,
 		Params:           make(map[string]string),
+		Exported:         make(map[string]bool),
+		ReadOnly:         make(map[string]bool),
+		PositionalParams: append([]string{}, e.PositionalParams...),
+		ShellName:        e.ShellName,
+		Status:           e.Status,
+		Aliases:          make(map[string]string),
+		Functions:        make(map[string]*ast.FunctionDefinition),
 		Files:            make(map[int]io.ReadWriteCloser),
+		Context:          e.Context,
+		Options:          e.Options,
+		errExitIgnored:   e.errExitIgnored,
+		tracing:          e.tracing,
+		openedFiles:      make(map[int]*openedFile),
 	}
 
 	for k, v := range e.Params {
 		commandExecEnv.Params[k] = v
 	}
 
+	for k, v := range e.Exported {
+		commandExecEnv.Exported[k] = v
+	}
+
+	for k, v := range e.ReadOnly {
+		commandExecEnv.ReadOnly[k] = v
+	}
+
+	for k, v := range e.Aliases {
+		commandExecEnv.Aliases[k] = v
+	}
+
+	for k, v := range e.Functions {
+		commandExecEnv.Functions[k] = v
+	}
+
 	for k, v := range e.Files {
 		commandExecEnv.Files[k] = v
 	}
@@ -102,7 +195,92 @@ func (e *ExecEnv) GetParam(key string) string {
 	return e.GetParamDefault(key, "")
 }
 
-// SetParam sets the value of the parameter variable named as key
+// SetParam sets the value of the parameter variable named as key, even if it is
+// read-only
 func (e *ExecEnv) SetParam(key string, value string) {
 	e.Params[key] = value
 }
+
+// Assign sets the value of the shell variable named as key, like a variable
+// assignment. Read-only variables cannot be assigned.
+func (e *ExecEnv) Assign(key string, value string) error {
+	if e.ReadOnly[key] {
+		return newAssignmentError(fmt.Errorf("%s: readonly variable", key))
+	}
+
+	e.Params[key] = value
+
+	return nil
+}
+
+// Unset removes the shell variable named as key, and its export attribute.
+// Read-only variables cannot be unset.
+func (e *ExecEnv) Unset(key string) error {
+	if e.ReadOnly[key] {
+		return newAssignmentError(fmt.Errorf("%s: readonly variable", key))
+	}
+
+	delete(e.Params, key)
+	delete(e.Exported, key)
+
+	return nil
+}
+
+// Sets the file of the file descriptor for good, or closes the file descriptor
+// if the file is nil. The owner is the file opened by the shell that the file
+// refers to, if any. The previous file of the file descriptor is closed if no
+// other file descriptor refers to it.
+func (e *ExecEnv) setFile(fd int, file io.ReadWriteCloser, owner *openedFile) {
+	previous := e.openedFiles[fd]
+
+	if file == nil {
+		delete(e.Files, fd)
+	} else {
+		e.Files[fd] = file
+	}
+
+	if owner == nil {
+		delete(e.openedFiles, fd)
+	} else {
+		e.openedFiles[fd] = owner
+	}
+
+	e.closeUnreferenced(previous)
+}
+
+// Closes the files opened by the shell for this environment, when it exits (like
+// a subshell environment)
+func (e *ExecEnv) closeFiles() {
+	for fd, file := range e.openedFiles {
+		delete(e.openedFiles, fd)
+		e.closeUnreferenced(file)
+	}
+}
+
+// Closes the file opened by the shell if no file descriptor refers to it
+func (e *ExecEnv) closeUnreferenced(file *openedFile) {
+	if file == nil {
+		return
+	}
+
+	for _, f := range e.openedFiles {
+		if f == file {
+			return
+		}
+	}
+
+	file.Close()
+}
+
+// Returns the exported shell variables that are set, which are the environment
+// of the commands
+func (e *ExecEnv) Environ() map[string]string {
+	environ := map[string]string{}
+	for k := range e.Exported {
+		if value, exists := e.Params[k]; exists {
+			environ[k] = value
+		}
+	}
+
+	return environ
+}
@@ -5,15 +5,21 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/omerhorev/gobash/ast"
 	"github.com/omerhorev/gobash/command"
 	"github.com/omerhorev/gobash/utils"
 
 	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
 )
 
 // internally used to represent io redirections
@@ -29,8 +35,44 @@ type OpenFileFunc func(path string, flag int, perm os.FileMode) (io.ReadWriteClo
 // Will be used when changing a folder using cd
 type ChangeDirFunc func(path string) (newPath string, err error)
 
+// Returns the home directory of the user
+type HomeDirFunc func(user string) (dir string, err error)
+
+// Receives the trace of each simple command executed with xtrace (set -x)
+type TraceFunc func(trace Trace)
+
+// The trace of a simple command, as written by xtrace (set -x) before the
+// command is executed
+type Trace struct {
+	Assignments map[string]string // the expanded variable assignments
+	Args        []string          // the expanded command name and arguments
+}
+
+// Returns the traced command as it is written by xtrace (set -x), without the
+// PS4 prefix. The words are quoted, so it can be reinput to the shell.
+func (t Trace) String() string {
+	names := []string{}
+	for name := range t.Assignments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	words := []string{}
+	for _, name := range names {
+		words = append(words, name+"="+shellQuote(t.Assignments[name]))
+	}
+
+	for _, arg := range t.Args {
+		words = append(words, shellQuote(arg))
+	}
+
+	return strings.Join(words, " ")
+}
+
 const (
-	defaultIFS = "\n\t "
+	defaultIFS = " \t\n"
+	defaultPS4 = "+ "
 	retErr     = 127 // the return code when error happens
 )
 
@@ -49,6 +91,15 @@ type ExecutorSettings struct {
 	// if null, implementation based on os.Stat will be used
 	CdFunc ChangeDirFunc
 
+	// The method used in tilde expansion to find the home directory of a user (~user)
+	// if null, implementation based on os/user will be used
+	HomeDirFunc HomeDirFunc
+
+	// The file system used to list directories in pathname expansion (globbing).
+	// Paths are resolved from the root of the file system, so `/tmp/*` lists the
+	// directory `tmp`. If null, the os file system rooted at / will be used
+	FS fs.FS
+
 	// Disable opening new files by the shell
 	// If set, the following commands will result an error:
 	//  - `echo 1 > /tmp/x`
@@ -66,6 +117,11 @@ type ExecutorSettings struct {
 	// Exit the execution when an unknown command error happens
 	// (see 2.8.1 Consequences of Shell Errors)
 	StopOnUnknownCommand bool
+
+	// Receives the trace of each simple command when xtrace (set -x) is enabled,
+	// instead of writing it to stderr. It may be called concurrently by the
+	// commands of a pipeline. If null, the trace is written to stderr
+	TraceFunc TraceFunc
 }
 
 // The Executor receives an AST and executes it.
@@ -73,10 +129,10 @@ type ExecutorSettings struct {
 // The key differences are:
 // - commands: The Executor supports special commands that connect to a Golang method. Use RegisterCommand to add such commands.
 type Executor struct {
-	Settings     ExecutorSettings  // Settings for the executor
-	ExecEnv      *ExecEnv          // The current execution environment (env-vars, open files, etc)
-	Commands     []command.Command // The current registered command
-	astNodeStack []ast.Node        // the current ast node stack
+	Settings ExecutorSettings  // Settings for the executor
+	ExecEnv  *ExecEnv          // The current execution environment (env-vars, open files, options, etc)
+	Commands []command.Command // The current registered command
+	jobs     *jobTable         // the background jobs
 }
 
 // Creates a new executor with settings. The newly created Executor has no
@@ -84,10 +140,18 @@ type Executor struct {
 // fields.
 func NewExecutor(settings ExecutorSettings) *Executor {
 	executor := &Executor{
-		Settings:     settings,
-		Commands:     []command.Command{},
-		ExecEnv:      newExecEnv(),
-		astNodeStack: []ast.Node{},
+		Settings: settings,
+		Commands: []command.Command{},
+		ExecEnv:  newExecEnv(),
+		jobs:     newJobTable(),
+	}
+
+	// with the os file system, relative pathnames are resolved from the working
+	// directory of the process, just like the files opened by the shell
+	if settings.FS == nil {
+		if dir, err := os.Getwd(); err == nil {
+			executor.ExecEnv.WorkingDirectory = dir
+		}
 	}
 
 	return executor
@@ -96,12 +160,25 @@ func NewExecutor(settings ExecutorSettings) *Executor {
 // Run the program specified.
 //
 // The program will be executed on the same Goroutine and will block until
-// it finishes execution.
+// it finishes execution. When the shell exits (like with the exit special
+// built-in), an ExitError with the exit status of the shell is returned.
+// Otherwise, the exit status of the last command is kept in ExecEnv.Status.
 func (e *Executor) Run(program *ast.Program) error {
 	_, err := e.executeNode(program, e.ExecEnv)
+	if status, ok := exitStatus(err); ok {
+		return ExitError{Status: status}
+	}
+
 	return err
 }
 
+// Returns the background jobs known to the executor, ordered by their start time.
+// A job is forgotten once its exit status is reported by the shell (see the
+// wait, fg and jobs built-ins).
+func (e *Executor) Jobs() []*Job {
+	return e.jobs.all()
+}
+
 // Register a one or more new commands
 //
 // For example, add all the default commands:
@@ -153,20 +230,34 @@ func (e *Executor) SetStderr(w io.Writer) {
 // Change the shell's working directory.
 // This method will use the CdFunc in the settings if one exists.
 func (e *Executor) Cd(path string) error {
-	cdFunc := e.cdFunc()
+	return e.cd(path, e.ExecEnv)
+}
 
-	newPath, err := cdFunc(path)
+// Changes the working directory of the environment
+func (e *Executor) cd(path string, env *ExecEnv) error {
+	newPath, err := e.cdFunc(env)(path)
 	if err != nil {
 		return err
 	}
 
-	e.ExecEnv.WorkingDirectory = newPath
+	env.WorkingDirectory = newPath
 
 	return nil
 }
 
-func (e *Executor) getCommand(name string) (command.Command, error) {
-	commands := append(e.Commands, &cdBuiltinCommand{Executor: e})
+// Returns the command with the name provided. Built-ins that affect the shell
+// operate on the environment provided.
+func (e *Executor) getCommand(name string, env *ExecEnv) (command.Command, error) {
+	// see 2.9.1.1 Command Search and Execution
+	commands := []command.Command{}
+	commands = append(commands, e.specialBuiltins(env)...)
+	if function, exists := env.Functions[name]; exists {
+		commands = append(commands, &functionCommand{Executor: e, env: env, Function: function})
+	}
+	commands = append(commands, e.Commands...)
+	commands = append(commands, &cdBuiltinCommand{Executor: e, env: env})
+	commands = append(commands, e.aliasBuiltins(env)...)
+	commands = append(commands, e.jobControlBuiltins()...)
 
 	for _, command := range commands {
 		if command.Match(name) {
@@ -178,7 +269,17 @@ func (e *Executor) getCommand(name string) (command.Command, error) {
 }
 
 func (e *Executor) executeNode(node ast.Node, env *ExecEnv) (ret int, err error) {
-	e.astNodeStack = append(e.astNodeStack, node)
+	// the execution was canceled (like a killed job), unwind it
+	if env.Context.Err() != nil {
+		return retErr, canceledError{}
+	}
+
+	// with noexec (set -n), the commands are read but not executed
+	if env.Options.NoExec && !env.Options.Interactive && !isWordNode(node) {
+		if _, ok := node.(*ast.Program); !ok {
+			return 0, nil
+		}
+	}
 
 	switch n := node.(type) {
 	case *ast.Background:
@@ -194,73 +295,304 @@ func (e *Executor) executeNode(node ast.Node, env *ExecEnv) (ret int, err error)
 	case *ast.Expr:
 		ret, err = e.executeExpr(n, env)
 	case *ast.Backtick:
-		ret, err = e.executeBacktick(n, env)
+		ret, err = e.executeCommandSubstitution(n.Node, env)
+	case *ast.CommandSubstitution:
+		ret, err = e.executeCommandSubstitution(n.Node, env)
+	case *ast.Arithmetic:
+		ret, err = e.executeArithmetic(n, env)
+	case *ast.Tilde:
+		ret, err = e.executeTilde(n, env)
+	case *ast.Param:
+		ret, err = e.executeParam(n, env)
+	case *ast.SingleQuote:
+		ret, err = e.executeSingleQuote(n, env)
+	case *ast.DoubleQuote:
+		ret, err = e.executeDoubleQuote(n, env)
+	case *ast.Escaped:
+		ret, err = e.executeEscaped(n, env)
 	case *ast.Program:
 		ret, err = e.executeProgram(n, env)
+	case *ast.If:
+		ret, err = e.executeIf(n, env)
+	case *ast.While:
+		ret, err = e.executeLoop(n.Condition, n.Body, false, env)
+	case *ast.Until:
+		ret, err = e.executeLoop(n.Condition, n.Body, true, env)
+	case *ast.For:
+		ret, err = e.executeFor(n, env)
+	case *ast.Case:
+		ret, err = e.executeCase(n, env)
+	case *ast.BraceGroup:
+		ret, err = e.executeList(n.Commands, env)
+	case *ast.Subshell:
+		ret, err = e.executeSubshell(n.Commands, env)
+	case *ast.Redirect:
+		ret, err = e.executeRedirect(n, env)
+	case *ast.FunctionDefinition:
+		ret, err = e.executeFunctionDefinition(n, env)
+	case *ast.Not:
+		ret, err = e.executeNot(n, env)
 	default:
 		ret, err = retErr, fmt.Errorf("unsupported execution %T", n)
 	}
 
-	e.astNodeStack = e.astNodeStack[:len(e.astNodeStack)-1]
-
-	if newErr := e.HandleError(err); newErr != nil {
+	if newErr := e.handleError(err, env); newErr != nil {
 		ret, err = retErr, newErr
 	} else {
 		err = nil
 	}
 
+	// the exit status of the shell is kept while it exits
+	if status, ok := exitStatus(err); ok {
+		ret = status
+	}
+
+	// with errexit (set -e), a failed command exits the shell. Only the failure
+	// of a whole pipeline is considered, and the failure of a compound command is
+	// the failure of the last command it executed.
+	if err == nil && ret != 0 && env.Options.ErrExit && env.errExitIgnored == 0 {
+		switch node.(type) {
+		case *ast.SimpleCommand, *ast.Pipe, *ast.Subshell:
+			err = ExitError{Status: ret}
+		}
+	}
+
+	// the exit status of the last command is kept for $?, the word expansions
+	// (which are also executed as nodes) do not affect it
+	if !isWordNode(node) {
+		env.Status = ret
+	}
+
 	return
 }
 
 func (e *Executor) executeProgram(node *ast.Program, env *ExecEnv) (int, error) {
+	ret := 0
+
 	for _, node := range node.Commands {
-		if _, err := e.executeNode(node, env); err != nil {
+		var err error
+		if ret, err = e.executeNode(node, env); err != nil {
+			// break and continue outside of a loop are ignored
+			if isLoopControlError(err) {
+				continue
+			}
+
+			// return outside of a function stops the execution of the program
+			var r returnError
+			if errors.As(err, &r) {
+				return r.Status, nil
+			}
+
 			return retErr, err
 		}
 	}
 
-	return 0, nil
+	return ret, nil
 }
 
-func (e *Executor) isRunInBackground() bool {
-	for i := range e.astNodeStack {
-		v := e.astNodeStack[len(e.astNodeStack)-1-i]
-		if _, ok := v.(ast.Background); ok {
-			return true
+// Executes a list of commands like executeList, as a condition whose failure does
+// not exit the shell with errexit (set -e)
+func (e *Executor) executeCondition(nodes []ast.Node, env *ExecEnv) (int, error) {
+	env.errExitIgnored++
+	defer func() { env.errExitIgnored-- }()
+
+	return e.executeList(nodes, env)
+}
+
+// Executes a list of commands one after the other and returns the exit status
+// of the last command
+func (e *Executor) executeList(nodes []ast.Node, env *ExecEnv) (int, error) {
+	ret := 0
+
+	for _, node := range nodes {
+		var err error
+		if ret, err = e.executeNode(node, env); err != nil {
+			return retErr, err
 		}
 	}
 
-	return false
+	return ret, nil
 }
 
-func (e *Executor) executeExpr(node *ast.Expr, env *ExecEnv) (int, error) {
-	b := bytes.Buffer{}
+func (e *Executor) executeIf(node *ast.If, env *ExecEnv) (int, error) {
+	ret, err := e.executeCondition(node.Condition, env)
+	if err != nil {
+		return retErr, err
+	}
 
-	for _, n := range node.Nodes {
-		b.Reset()
+	if ret == 0 {
+		return e.executeList(node.Then, env)
+	}
+
+	// an if without else returns zero if no list was executed
+	return e.executeList(node.Else, env)
+}
+
+// Executes a while loop, or an until loop if until is set. The exit status is
+// the one of the last body execution, or zero if the body was never executed.
+func (e *Executor) executeLoop(condition []ast.Node, body []ast.Node, until bool, env *ExecEnv) (int, error) {
+	ret := 0
+
+	for {
+		conditionRet, err := e.executeCondition(condition, env)
+		if err != nil {
+			if exit, err := unwindLoop(err); exit {
+				return 0, err
+			}
+
+			continue
+		}
+
+		if (conditionRet == 0) == until {
+			return ret, nil
+		}
+
+		ret, err = e.executeList(body, env)
+		if err != nil {
+			if exit, err := unwindLoop(err); exit {
+				return 0, err
+			}
+
+			// the exit status of continue
+			ret = 0
+		}
+	}
+}
+
+func (e *Executor) executeFor(node *ast.For, env *ExecEnv) (int, error) {
+	// without a word list the loop iterates over "$@"
+	words := append([]string{}, env.PositionalParams...)
+
+	if node.Words != nil {
+		var err error
+		if words, err = e.expandWords(node.Words, env); err != nil {
+			return retErr, err
+		}
+	}
 
-		if _, err := e.executeNodeOverrideStdInOut(n, env, env.Stdin(), &b); err != nil {
+	ret := 0
+
+	for _, word := range words {
+		if err := env.Assign(node.Name, word); err != nil {
 			return retErr, err
 		}
 
-		if _, ok := n.(ast.DoubleQuote); !ok {
-			sb := bufio.NewWriter(env.Stdout())
+		var err error
+		ret, err = e.executeList(node.Body, env)
+		if err != nil {
+			if exit, err := unwindLoop(err); exit {
+				return 0, err
+			}
+
+			// the exit status of continue
+			ret = 0
+		}
+	}
 
-			s := e.newFieldSplitScanner(&b)
-			more := s.Scan()
-			for more {
-				sb.WriteString(s.Text())
+	return ret, nil
+}
 
-				more = s.Scan()
+func (e *Executor) executeCase(node *ast.Case, env *ExecEnv) (int, error) {
+	word, err := e.expandExpr(node.Word, env)
+	if err != nil {
+		return retErr, err
+	}
 
-				if more {
-					sb.WriteRune(' ')
-				}
+	for _, item := range node.Items {
+		for _, p := range item.Patterns {
+			pattern, err := e.expandPattern(p, env)
+			if err != nil {
+				return retErr, err
 			}
 
-			sb.Flush()
-		} else {
-			io.Copy(env.Stdout(), &b)
+			if matchPattern(pattern, word) {
+				return e.executeList(item.Body, env)
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// Handles an error raised inside a loop. Returns whether the loop should be exited,
+// and the error that should be propagated further up the AST.
+func unwindLoop(err error) (exit bool, newErr error) {
+	var control loopControlError
+	if !errors.As(err, &control) {
+		return true, err
+	}
+
+	if control.Count > 1 {
+		control.Count--
+		return true, control
+	}
+
+	return !control.Continue, nil
+}
+
+func (e *Executor) executeRedirect(node *ast.Redirect, env *ExecEnv) (int, error) {
+	redirects, err := e.expandRedirects(node.Redirects, env)
+	if err != nil {
+		return retErr, err
+	}
+
+	restore, err := e.redirect(redirects, env)
+	if err != nil {
+		return retErr, err
+	}
+	defer restore()
+
+	return e.executeNode(node.Child, env)
+}
+
+func (e *Executor) executeFunctionDefinition(node *ast.FunctionDefinition, env *ExecEnv) (int, error) {
+	env.Functions[node.Name] = node
+	return 0, nil
+}
+
+// Executes the child and negates its exit status (see 2.9.2 Pipelines)
+func (e *Executor) executeNot(node *ast.Not, env *ExecEnv) (int, error) {
+	ret, err := e.executeCondition([]ast.Node{node.Child}, env)
+	if err != nil {
+		return retErr, err
+	}
+
+	if ret == 0 {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Executes the nodes of the expression one after the other, so the expansion of
+// the expression is written as a single string. Field splitting is not applied
+// here, see expandFields.
+func (e *Executor) executeExpr(node *ast.Expr, env *ExecEnv) (int, error) {
+	for _, n := range node.Nodes {
+		if _, err := e.executeNode(n, env); err != nil {
+			return retErr, err
+		}
+	}
+
+	return 0, nil
+}
+
+func (e *Executor) executeSingleQuote(node *ast.SingleQuote, env *ExecEnv) (int, error) {
+	env.Stdout().Write([]byte(node.Value))
+
+	return 0, nil
+}
+
+func (e *Executor) executeEscaped(node *ast.Escaped, env *ExecEnv) (int, error) {
+	env.Stdout().Write([]byte(node.Value))
+
+	return 0, nil
+}
+
+func (e *Executor) executeDoubleQuote(node *ast.DoubleQuote, env *ExecEnv) (int, error) {
+	for _, n := range node.Nodes {
+		if _, err := e.executeNode(n, env); err != nil {
+			return retErr, err
 		}
 	}
 
@@ -273,18 +605,95 @@ func (e *Executor) executeString(node *ast.String, env *ExecEnv) (int, error) {
 	return 0, nil
 }
 
-func (e *Executor) executeBacktick(node *ast.Backtick, env *ExecEnv) (int, error) {
-	return e.executeNode(node.Node, env)
+// Executes the program of a command substitution (`program` or $(program)) in a
+// subshell environment and writes its output, without the trailing newlines
+// (see 2.6.3 Command Substitution)
+func (e *Executor) executeCommandSubstitution(node ast.Node, env *ExecEnv) (int, error) {
+	b := bytes.Buffer{}
+
+	ret, err := e.executeNodeOverrideStdInOut(node, env, env.Stdin(), &b)
+	if err != nil {
+		return retErr, err
+	}
+
+	env.Stdout().Write(bytes.TrimRight(b.Bytes(), "\n"))
+	env.substitutionStatus = ret
+
+	return ret, nil
 }
 
+// Writes the home directory of the user of the tilde-prefix (see 2.6.1 Tilde
+// Expansion). The home directory of the current user is HOME. If the home
+// directory is unknown, the tilde-prefix is kept as is.
+func (e *Executor) executeTilde(node *ast.Tilde, env *ExecEnv) (int, error) {
+	dir := ""
+	found := false
+
+	if node.User == "" {
+		dir, found = env.Params["HOME"]
+	} else if home, err := e.homeDirFunc()(node.User); err == nil {
+		dir, found = home, true
+	}
+
+	if !found {
+		dir = "~" + node.User
+	}
+
+	env.Stdout().Write([]byte(dir))
+
+	return 0, nil
+}
+
+// Expands and evaluates the arithmetic expression and writes its value (see
+// 2.6.4 Arithmetic Expansion)
+func (e *Executor) executeArithmetic(node *ast.Arithmetic, env *ExecEnv) (int, error) {
+	expression, err := e.expandExpr(node.Expr, env)
+	if err != nil {
+		return retErr, err
+	}
+
+	value, err := evalArith(expression, env)
+	if err != nil {
+		return retErr, err
+	}
+
+	env.Stdout().Write([]byte(strconv.FormatInt(value, 10)))
+
+	return 0, nil
+}
+
+func (e *Executor) executeParam(node *ast.Param, env *ExecEnv) (int, error) {
+	value, err := e.expandParam(node, env)
+	if err != nil {
+		return retErr, err
+	}
+
+	env.Stdout().Write([]byte(value))
+
+	return 0, nil
+}
+
+// Executes the child asynchronously as a new job (see 2.9.3.1 Asynchronous
+// Lists). The job is executed in a copy of the current environment with stdin
+// redirected from a null device, unless it is explicitly redirected.
 func (e *Executor) executeBackground(node *ast.Background, env *ExecEnv) (int, error) {
-	e.executeNode(node.Child, env)
+	jobEnv := env.New()
+	jobEnv.Files[0] = &utils.ErrorReadWriterErrW{Reader: io.NopCloser(utils.Null)}
+
+	var j *Job
+	j, jobEnv.Context = e.jobs.add(env.Context, node.Child, node.Text)
+
+	go func() {
+		ret, _ := e.executeNode(node.Child, jobEnv)
+		jobEnv.closeFiles()
+		j.finish(ret)
+	}()
 
 	return 0, nil
 }
 
 func (e *Executor) executeBinary(node *ast.Binary, env *ExecEnv) (int, error) {
-	ret, err := e.executeNode(node.Left, env)
+	ret, err := e.executeCondition([]ast.Node{node.Left}, env)
 	if err != nil {
 		return retErr, err
 	}
@@ -311,8 +720,9 @@ func (e *Executor) executePipe(node *ast.Pipe, env *ExecEnv) (int, error) {
 	}
 
 	// setup stdin, stdout and stderr
-	_r := io.NopCloser(e.ExecEnv.Stdin())
+	_r := io.NopCloser(env.Stdin())
 	wg := sync.WaitGroup{}
+	statuses := make([]int, len(node.Commands))
 
 	for i := 0; i < len(node.Commands)-1; i++ {
 		n := node.Commands[i]
@@ -320,78 +730,167 @@ func (e *Executor) executePipe(node *ast.Pipe, env *ExecEnv) (int, error) {
 		r, w := io.Pipe()
 
 		wg.Add(1)
-		go func(reader io.ReadCloser, writer io.WriteCloser) {
-			e.executeNodeOverrideStdInOut(n, env, reader, writer)
+		go func(i int, reader io.ReadCloser, writer io.WriteCloser) {
+			statuses[i], _ = e.executeNodeOverrideStdInOut(n, env, reader, writer)
 			writer.Close()
 			reader.Close()
 
 			wg.Done()
-		}(_r, w)
+		}(i, _r, w)
 
 		_r = r
 	}
 
 	n := node.Commands[len(node.Commands)-1]
-	ret, err := e.executeNodeOverrideStdInOut(n, env, _r, e.ExecEnv.Stdout())
+	ret, err := e.executeNodeOverrideStdInOut(n, env, _r, env.Stdout())
 	_r.Close()
 
 	wg.Wait()
 
+	// with pipefail, the exit status is the one of the last command that failed
+	if err == nil && env.Options.PipeFail {
+		statuses[len(statuses)-1] = ret
+		for _, status := range statuses {
+			if status != 0 {
+				ret = status
+			}
+		}
+	}
+
 	return ret, err
 }
 
+// Executes the simple command (see 2.9.1 Simple Commands). Without a command
+// name, the variable assignments affect the current environment and the exit
+// status is the one of the last command substitution. Otherwise, they are
+// exported to the command only, except for special built-ins that keep them.
 func (e *Executor) executeSimpleCommand(node *ast.SimpleCommand, env *ExecEnv) (int, error) {
-	name, args, assignments, redirects, err := e.expandSimpleCommand(node)
+	env.substitutionStatus = 0
+
+	words, assignments, redirects, err := e.expandSimpleCommand(node, env)
 	if err != nil {
 		return retErr, err
 	}
 
-	newEnv := env.New()
+	e.trace(words, assignments, env)
 
-	for _, v := range redirects {
-		if file, err := e.getIORedirectFile(v, newEnv); err != nil {
+	// the redirections of exec without a command affect the current environment
+	if len(words) == 1 && e.isExec(words[0]) {
+		if err := e.redirectPermanently(redirects, env); err != nil {
+			return retErr, err
+		}
+	} else {
+		restore, err := e.redirect(redirects, env)
+		if err != nil {
 			return retErr, err
-		} else {
-			defer file.Close()
-
-			newEnv.Files[v.Fd] = file
 		}
+		defer restore()
 	}
 
-	cmdEnv := e.createCommandEnv(newEnv)
-	for k, v := range assignments {
-		cmdEnv.Env[k] = v
+	if len(words) == 0 {
+		for k, v := range assignments {
+			if err := env.Assign(k, v); err != nil {
+				return retErr, err
+			}
+		}
+
+		return env.substitutionStatus, nil
 	}
-	cmdEnv.Args = append([]string{name}, args...)
 
-	if e.isRunInBackground() {
-		// TODO: run in background
-		return retErr, errors.New("unimplemented")
+	for k := range assignments {
+		if env.ReadOnly[k] {
+			return retErr, newAssignmentError(fmt.Errorf("%s: readonly variable", k))
+		}
 	}
 
-	cmd, err := e.getCommand(name)
+	name := words[0]
+
+	cmd, err := e.getCommand(name, env)
 	if err != nil {
 		return retErr, err
 	}
 
+	if e.isSpecialBuiltin(name, env) {
+		for k, v := range assignments {
+			if err := env.Assign(k, v); err != nil {
+				return retErr, err
+			}
+		}
+	}
+
+	cmdEnv := e.createCommandEnv(env)
+	for k, v := range assignments {
+		cmdEnv.Env[k] = v
+	}
+	cmdEnv.Args = words
+
+	if flowCmd, ok := cmd.(flowCommand); ok {
+		return flowCmd.ExecuteFlow(cmdEnv.Args, cmdEnv)
+	}
+
 	return cmd.Execute(cmdEnv.Args, cmdEnv), nil
 }
 
+// Applies the IO redirections to the files of the environment. The returned
+// function restores the files of the environment and closes the files opened
+// by the redirections.
+func (e *Executor) redirect(redirects []*ioRedirection, env *ExecEnv) (restore func(), err error) {
+	saved := map[int]io.ReadWriteCloser{}
+	opened := []io.Closer{}
+
+	restore = func() {
+		for _, file := range opened {
+			file.Close()
+		}
+
+		for fd, file := range saved {
+			if file == nil {
+				delete(env.Files, fd)
+			} else {
+				env.Files[fd] = file
+			}
+		}
+	}
+
+	for _, v := range redirects {
+		if _, exists := saved[v.Fd]; !exists {
+			saved[v.Fd] = env.Files[v.Fd]
+		}
+
+		// n<&- and n>&- close the file descriptor
+		if v.Mode.IsDup() && v.To == "-" {
+			delete(env.Files, v.Fd)
+			continue
+		}
+
+		file, err := e.getIORedirectFile(v, env)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+
+		// duplicated files are closed by their original owner
+		if !v.Mode.IsDup() {
+			opened = append(opened, file)
+		}
+
+		env.Files[v.Fd] = file
+	}
+
+	return restore, nil
+}
+
 func (e *Executor) createCommandEnv(env *ExecEnv) *command.Env {
 	filesWithoutClose := map[int]io.ReadWriter{}
 	for fd, f := range env.Files {
 		filesWithoutClose[fd] = f
 	}
 
-	envVars := map[string]string{}
-	for k, v := range env.Params {
-		envVars[k] = v
-	}
-
 	return &command.Env{
 		Files:    filesWithoutClose,
-		Env:      envVars,
-		OpenFunc: e.openFileFunc(),
+		Env:      env.Environ(),
+		OpenFunc: e.openFileFunc(env),
+		Context:  env.Context,
 	}
 }
 
@@ -399,8 +898,76 @@ func (e *Executor) executeNodeOverrideStdInOut(node ast.Node, env *ExecEnv, in i
 	envCopy := env.New()
 	envCopy.Files[0] = &utils.ErrorReadWriterErrW{Reader: in}
 	envCopy.Files[1] = &utils.ErrorReadWriterErrR{Writer: out}
+	defer envCopy.closeFiles()
 
-	return e.executeNode(node, envCopy)
+	return subshellStatus(e.executeNode(node, envCopy))
+}
+
+// Executes a list of commands in a subshell environment (see 2.12 Shell
+// Execution Environment). Exiting the subshell does not exit the shell.
+func (e *Executor) executeSubshell(nodes []ast.Node, env *ExecEnv) (int, error) {
+	subshellEnv := env.New()
+	defer subshellEnv.closeFiles()
+
+	return subshellStatus(e.executeList(nodes, subshellEnv))
+}
+
+// Returns the exit status of a subshell environment that stopped with the error.
+// Exiting the subshell, returning from it or an error that stopped it (like an
+// expansion error) does not stop the shell, so they only set the exit status.
+// The error was already reported by the subshell. Only cancellation goes on.
+func subshellStatus(ret int, err error) (int, error) {
+	if err == nil || errors.Is(err, canceledError{}) {
+		return ret, err
+	}
+
+	if status, ok := exitStatus(err); ok {
+		return status, nil
+	}
+
+	var r returnError
+	if errors.As(err, &r) {
+		return r.Status, nil
+	}
+
+	if isLoopControlError(err) {
+		return 0, nil
+	}
+
+	if ret == 0 {
+		ret = retErr
+	}
+
+	return ret, nil
+}
+
+// Applies the redirections to the environment for good, like the redirections of
+// exec without a command. The files opened by the shell are closed once no file
+// descriptor refers to them.
+func (e *Executor) redirectPermanently(redirects []*ioRedirection, env *ExecEnv) error {
+	for _, v := range redirects {
+		// n<&- and n>&- close the file descriptor
+		if v.Mode.IsDup() && v.To == "-" {
+			env.setFile(v.Fd, nil, nil)
+			continue
+		}
+
+		file, err := e.getIORedirectFile(v, env)
+		if err != nil {
+			return err
+		}
+
+		// duplicated files refer to the file of their original file descriptor
+		owner := &openedFile{file}
+		if v.Mode.IsDup() {
+			fd, _ := strconv.Atoi(v.To)
+			owner = env.openedFiles[fd]
+		}
+
+		env.setFile(v.Fd, file, owner)
+	}
+
+	return nil
 }
 
 func (e *Executor) getIORedirectFile(redirection *ioRedirection, env *ExecEnv) (io.ReadWriteCloser, error) {
@@ -421,6 +988,8 @@ func (e *Executor) getIORedirectFile(redirection *ioRedirection, env *ExecEnv) (
 			return &utils.ErrorReadWriterErrW{Reader: file}, nil
 		}
 
+	} else if redirection.Mode == ast.IORedirectionModeHereDoc || redirection.Mode == ast.IORedirectionModeHereDocStrip {
+		return &utils.ErrorReadWriterErrW{Reader: strings.NewReader(redirection.To)}, nil
 	} else {
 		path := redirection.To
 		flags := 0
@@ -429,14 +998,21 @@ func (e *Executor) getIORedirectFile(redirection *ioRedirection, env *ExecEnv) (
 		case ast.IORedirectionModeInput:
 			flags = os.O_RDONLY
 		case ast.IORedirectionModeOutput:
+			// with noclobber (set -C), > does not overwrite regular files
+			if env.Options.NoClobber {
+				return e.openNoClobber(path, env)
+			}
+
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		case ast.IORedirectionModeOutputForce:
 			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
 		case ast.IORedirectionModeInputOutput:
-			flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+			flags = os.O_RDWR | os.O_CREATE
 		case ast.IORedirectionModeOutputAppend:
 			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
 		}
 
-		f, err := e.openFile(path, flags, 0666)
+		f, err := e.openFile(path, flags, 0666, env)
 		if err != nil {
 			return nil, newIORedirectionError(errors.Wrap(err, path))
 		}
@@ -445,35 +1021,108 @@ func (e *Executor) getIORedirectFile(redirection *ioRedirection, env *ExecEnv) (
 	}
 }
 
-func (e *Executor) openFile(path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+func (e *Executor) openFile(path string, flag int, perm os.FileMode, env *ExecEnv) (io.ReadWriteCloser, error) {
 	if e.Settings.DisableFileOpen {
 		return nil, errors.Errorf("open disabled")
 	}
 
-	return e.openFileFunc()(path, flag, perm)
+	return e.openFileFunc(env)(path, flag, perm)
 }
 
-func (e *Executor) openFileFunc() OpenFileFunc {
+// Returns the function that opens the files of the environment. By default, the
+// relative paths are opened from the working directory of the environment.
+func (e *Executor) openFileFunc(env *ExecEnv) OpenFileFunc {
 	if e.Settings.OpenFunc != nil {
 		return e.Settings.OpenFunc
 	}
 
 	return func(path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		if !filepath.IsAbs(path) && env.WorkingDirectory != "" {
+			path = filepath.Join(env.WorkingDirectory, path)
+		}
+
 		return os.OpenFile(path, flag, perm)
 	}
 }
 
-func (e *Executor) cdFunc() ChangeDirFunc {
+func (e *Executor) fileSystem() fs.FS {
+	if e.Settings.FS != nil {
+		return e.Settings.FS
+	}
+
+	return os.DirFS("/")
+}
+
+// Opens the file for the > redirection with noclobber (set -C). The file is
+// created exclusively, so an existing file is never truncated. An existing file
+// that is not a regular file (like /dev/null) is opened for writing as is. Files
+// that cannot report their mode are considered regular files.
+func (e *Executor) openNoClobber(path string, env *ExecEnv) (io.ReadWriteCloser, error) {
+	f, err := e.openFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666, env)
+	if err == nil {
+		return f, nil
+	} else if !errors.Is(err, fs.ErrExist) {
+		return nil, newIORedirectionError(errors.Wrap(err, path))
+	}
+
+	f, err = e.openFile(path, os.O_WRONLY, 0666, env)
+	if err != nil {
+		return nil, newIORedirectionError(errors.Wrap(err, path))
+	}
+
+	if statFile, ok := f.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := statFile.Stat(); err == nil && !info.Mode().IsRegular() {
+			return f, nil
+		}
+	}
+
+	f.Close()
+
+	return nil, newIORedirectionError(errors.Errorf("%s: cannot overwrite existing file", path))
+}
+
+func (e *Executor) homeDirFunc() HomeDirFunc {
+	if e.Settings.HomeDirFunc != nil {
+		return e.Settings.HomeDirFunc
+	}
+
+	return defaultHomeDirFunc
+}
+
+// Returns the function that changes the working directory of the environment.
+// By default, relative paths are resolved from the working directory of the
+// environment, and the working directory of the process is not changed.
+func (e *Executor) cdFunc(env *ExecEnv) ChangeDirFunc {
 	if e.Settings.CdFunc != nil {
 		return e.Settings.CdFunc
 	} else {
-		return defaultCdFunc
+		return func(path string) (string, error) {
+			return defaultCdFunc(env.WorkingDirectory, path)
+		}
 	}
 }
 
+// Reports the error to the stderr of the executor and returns whether the
+// execution should stop, see handleError
 func (e *Executor) HandleError(err error) error {
-	if err := e.error(err); err != nil {
-		return err
+	return e.handleError(err, e.ExecEnv)
+}
+
+// Reports the error to the stderr of the environment it happened in, once, and
+// returns the error if the execution should stop. The environment is the one of
+// the command that failed, so background jobs do not share the executor's files.
+func (e *Executor) handleError(err error, env *ExecEnv) error {
+	if err == nil {
+		return nil
+	}
+
+	// the error is propagated up the AST, report it only once
+	if !IsReportedError(err) {
+		if err := e.error(err, env); err != nil {
+			return err
+		}
+
+		err = newReportedError(err)
 	}
 
 	if IsIORedirectionError(err) {
@@ -495,30 +1144,35 @@ func (e *Executor) HandleError(err error) error {
 	return err
 }
 
-func (e *Executor) error(err error) (retErr error) {
-	if err != nil {
+func (e *Executor) error(err error, env *ExecEnv) (retErr error) {
+	// exiting the shell is not an actual error, nothing should be reported
+	if err != nil && !IsExitError(err) {
 		if str := err.Error(); str != "" {
-			_, retErr = e.ExecEnv.Stderr().Write([]byte(str + "\n"))
+			_, retErr = env.Stderr().Write([]byte(str + "\n"))
 		}
 	}
 
 	return
 }
 
-func (e *Executor) expandSimpleCommand(node *ast.SimpleCommand) (command string, args []string, assignments map[string]string, redirects []*ioRedirection, err error) {
-	command = ""
-	args = []string{}
+func (e *Executor) expandSimpleCommand(node *ast.SimpleCommand, env *ExecEnv) (words []string, assignments map[string]string, redirects []*ioRedirection, err error) {
 	assignments = map[string]string{}
 	redirects = []*ioRedirection{}
 	var val string
 
-	command, err = e.expandExpr(node.Word)
-	if err != nil {
+	// the command name and the arguments are expanded into fields, the first
+	// field is the command name
+	exprs := node.Args
+	if node.Word != nil {
+		exprs = append([]*ast.Expr{node.Word}, node.Args...)
+	}
+
+	if words, err = e.expandWords(exprs, env); err != nil {
 		return
 	}
 
 	for k, v := range node.Assignments {
-		val, err = e.expandExpr(v)
+		val, err = e.expandExpr(v, env)
 		if err != nil {
 			return
 		}
@@ -526,19 +1180,56 @@ func (e *Executor) expandSimpleCommand(node *ast.SimpleCommand) (command string,
 		assignments[k] = val
 	}
 
-	for _, v := range node.Args {
-		val, err = e.expandExpr(v)
-		if err != nil {
-			return
-		}
+	redirects, err = e.expandRedirects(node.Redirects, env)
+
+	return
+}
 
-		args = append(args, val)
+// Traces the expanded simple command when xtrace (set -x) is enabled. The trace is
+// written to stderr prefixed by the expansion of PS4, unless a TraceFunc is set.
+func (e *Executor) trace(words []string, assignments map[string]string, env *ExecEnv) {
+	if !env.Options.XTrace || env.tracing {
+		return
+	}
+
+	trace := Trace{Assignments: assignments, Args: words}
+
+	if e.Settings.TraceFunc != nil {
+		e.Settings.TraceFunc(trace)
+		return
+	}
+
+	io.WriteString(env.Stderr(), e.expandPS4(env)+trace.String()+"\n")
+}
+
+// Expands PS4, the prefix of the traces of xtrace (set -x). PS4 is expanded like
+// the body of a here-document. If the expansion fails, it is used as is.
+func (e *Executor) expandPS4(env *ExecEnv) string {
+	ps4 := env.GetParamDefault("PS4", defaultPS4)
+
+	expander := NewExpander(ps4)
+	if err := expander.ParseHereDoc(); err != nil {
+		return ps4
+	}
+
+	env.tracing = true
+	defer func() { env.tracing = false }()
+
+	value, err := e.expandExpr(expander.Expr, env)
+	if err != nil {
+		return ps4
 	}
 
-	for _, v := range node.Redirects {
-		val, err = e.expandExpr(v.Value)
+	return value
+}
+
+func (e *Executor) expandRedirects(nodes []*ast.IORedirection, env *ExecEnv) ([]*ioRedirection, error) {
+	redirects := []*ioRedirection{}
+
+	for _, v := range nodes {
+		val, err := e.expandRedirectTarget(v, env)
 		if err != nil {
-			return
+			return nil, err
 		}
 
 		redirects = append(redirects, &ioRedirection{
@@ -548,12 +1239,43 @@ func (e *Executor) expandSimpleCommand(node *ast.SimpleCommand) (command string,
 		})
 	}
 
-	return
+	return redirects, nil
+}
+
+// Expands the target of the redirection (see 2.7 Redirection). The target must
+// expand to a single field, and the body of a here-document is not split into
+// fields.
+func (e *Executor) expandRedirectTarget(node *ast.IORedirection, env *ExecEnv) (string, error) {
+	if node.Mode == ast.IORedirectionModeHereDoc || node.Mode == ast.IORedirectionModeHereDocStrip {
+		return e.expandExpr(node.Value, env)
+	}
+
+	fields, err := e.expandFieldPatterns(node.Value, env)
+	if err != nil {
+		return "", err
+	}
+
+	// pathname expansion is performed only by an interactive shell (see 2.7
+	// Redirection)
+	words := []string{}
+	for _, f := range fields {
+		if env.Options.Interactive {
+			words = append(words, e.expandPathname(f, env)...)
+		} else {
+			words = append(words, f.Value)
+		}
+	}
+
+	if len(words) != 1 {
+		return "", newIORedirectionError(errors.New("ambiguous redirect"))
+	}
+
+	return words[0], nil
 }
 
-func (e *Executor) expandExpr(node ast.Node) (string, error) {
+func (e *Executor) expandExpr(node ast.Node, env *ExecEnv) (string, error) {
 	b := bytes.Buffer{}
-	_, err := e.executeNodeOverrideStdInOut(node, e.ExecEnv, utils.Null, &b)
+	_, err := e.expandNode(node, env, &b)
 	if err != nil {
 		return "", err
 	}
@@ -561,12 +1283,401 @@ func (e *Executor) expandExpr(node ast.Node) (string, error) {
 	return b.String(), nil
 }
 
-func (e *Executor) newFieldSplitScanner(reader io.Reader) *bufio.Scanner {
-	return utils.NewRunesScanner(reader, e.getIFS())
+// Executes the word expansion node in the environment provided and writes the
+// result to the writer. Unlike executeNodeOverrideStdInOut, the environment is not
+// copied so expansions can affect it (like ${x:=y}).
+func (e *Executor) expandNode(node ast.Node, env *ExecEnv, w io.Writer) (int, error) {
+	stdout, exists := env.Files[1]
+	env.Files[1] = &utils.ErrorReadWriterErrR{Writer: w}
+
+	defer func() {
+		if exists {
+			env.Files[1] = stdout
+		} else {
+			delete(env.Files, 1)
+		}
+	}()
+
+	return e.executeNode(node, env)
+}
+
+// Returns whether the node is a part of a word (and not a command)
+func isWordNode(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.Expr, *ast.String, *ast.Backtick, *ast.CommandSubstitution, *ast.Arithmetic,
+		*ast.Param, *ast.SingleQuote, *ast.DoubleQuote, *ast.Escaped, *ast.Tilde:
+		return true
+	}
+
+	return false
+}
+
+// Returns the value of the parameter and whether it is set. The parameter can be
+// a variable, a positional parameter or a special parameter (see 2.5 Parameters
+// and Variables).
+func (e *Executor) getParam(name string, env *ExecEnv) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(env.Status), true
+	case "#":
+		return strconv.Itoa(len(env.PositionalParams)), true
+	case "@":
+		return strings.Join(env.PositionalParams, " "), len(env.PositionalParams) > 0
+	case "*":
+		return strings.Join(env.PositionalParams, e.getIFSSeparator(env)), len(env.PositionalParams) > 0
+	case "0":
+		return env.ShellName, true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		pid := e.jobs.lastBackgroundPid()
+		return strconv.Itoa(pid), pid != 0
+	case "-":
+		return env.Options.Flags(), true
+	}
+
+	if isDigit(rune(name[0])) {
+		n, _ := strconv.Atoi(name)
+		if n < 1 || n > len(env.PositionalParams) {
+			return "", false
+		}
+
+		return env.PositionalParams[n-1], true
+	}
+
+	value, set := env.Params[name]
+	return value, set
+}
+
+// Expands the parameter expansion into its value (see 2.6.2 Parameter Expansion)
+func (e *Executor) expandParam(node *ast.Param, env *ExecEnv) (string, error) {
+	value, set := e.getParam(node.Name, env)
+
+	// with nounset (set -u), expanding an unset parameter is an error, unless
+	// the operation handles unset parameters
+	if !set && env.Options.NoUnset && node.Name != "@" && node.Name != "*" {
+		switch node.Op {
+		case ast.ParamOpDefault, ast.ParamOpDefaultNull, ast.ParamOpAssign, ast.ParamOpAssignNull,
+			ast.ParamOpError, ast.ParamOpErrorNull, ast.ParamOpAlternative, ast.ParamOpAlternativeNull:
+		default:
+			return "", newExpansionError(fmt.Errorf("%s: parameter not set", node.Name))
+		}
+	}
+
+	// the operations with a colon also treat a null parameter as an unset one
+	if strings.HasPrefix(string(node.Op), ":") && value == "" {
+		set = false
+	}
+
+	switch node.Op {
+	case ast.ParamOpLength:
+		// the length of $@ and $* is the number of positional parameters
+		if node.Name == "@" || node.Name == "*" {
+			return strconv.Itoa(len(env.PositionalParams)), nil
+		}
+
+		return strconv.Itoa(utf8.RuneCountInString(value)), nil
+
+	case ast.ParamOpDefault, ast.ParamOpDefaultNull:
+		if !set {
+			return e.expandExpr(node.Word, env)
+		}
+
+	case ast.ParamOpAssign, ast.ParamOpAssignNull:
+		if !set {
+			if !isName(node.Name) {
+				return "", newExpansionError(fmt.Errorf("$%s: cannot assign in this way", node.Name))
+			}
+
+			word, err := e.expandExpr(node.Word, env)
+			if err != nil {
+				return "", err
+			}
+
+			if err := env.Assign(node.Name, word); err != nil {
+				return "", err
+			}
+
+			return word, nil
+		}
+
+	case ast.ParamOpError, ast.ParamOpErrorNull:
+		if !set {
+			message, err := e.expandExpr(node.Word, env)
+			if err != nil {
+				return "", err
+			}
+
+			if message == "" {
+				message = "parameter null or not set"
+			}
+
+			return "", newExpansionError(fmt.Errorf("%s: %s", node.Name, message))
+		}
+
+	case ast.ParamOpAlternative, ast.ParamOpAlternativeNull:
+		if set {
+			return e.expandExpr(node.Word, env)
+		}
+
+		return "", nil
+
+	case ast.ParamOpRemoveSmallestSuffix, ast.ParamOpRemoveLargestSuffix,
+		ast.ParamOpRemoveSmallestPrefix, ast.ParamOpRemoveLargestPrefix:
+		pattern, err := e.expandPattern(node.Word, env)
+		if err != nil {
+			return "", err
+		}
+
+		suffix := node.Op == ast.ParamOpRemoveSmallestSuffix || node.Op == ast.ParamOpRemoveLargestSuffix
+		largest := node.Op == ast.ParamOpRemoveLargestSuffix || node.Op == ast.ParamOpRemoveLargestPrefix
+
+		return removePattern(value, pattern, suffix, largest), nil
+	}
+
+	return value, nil
+}
+
+// Expands the expression into a pattern to be used with matchPattern. The quoted
+// characters are escaped, so they match themselves.
+func (e *Executor) expandPattern(node *ast.Expr, env *ExecEnv) (string, error) {
+	pattern := strings.Builder{}
+
+	for _, n := range node.Nodes {
+		s, err := e.expandExpr(n, env)
+		if err != nil {
+			return "", err
+		}
+
+		if isQuoteNode(n) {
+			s = escapePattern(s)
+		}
+
+		pattern.WriteString(s)
+	}
+
+	return pattern.String(), nil
+}
+
+// Returns whether the node is quoted, so its result is not split into fields
+// or used as a pattern
+func isQuoteNode(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.SingleQuote, *ast.DoubleQuote, *ast.Escaped, *ast.Tilde:
+		return true
+	}
+
+	return false
+}
+
+// Expands the expression into fields. The results of expansions are split into
+// fields using IFS (see 2.6.5 Field Splitting), while literal strings and double
+// quoted expansions are kept intact and joined to the adjacent fields. Inside
+// double quotes, $@ expands to a separate field for every positional parameter.
+func (e *Executor) expandFields(node *ast.Expr, env *ExecEnv) ([]string, error) {
+	fields, err := e.expandFieldPatterns(node, env)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []string{}
+	for _, f := range fields {
+		values = append(values, f.Value)
+	}
+
+	return values, nil
+}
+
+// Expands the words into fields, followed by pathname expansion of each field
+// (see 2.6 Word Expansions)
+func (e *Executor) expandWords(nodes []*ast.Expr, env *ExecEnv) ([]string, error) {
+	words := []string{}
+
+	for _, node := range nodes {
+		fields, err := e.expandFieldPatterns(node, env)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fields {
+			words = append(words, e.expandPathname(f, env)...)
+		}
+	}
+
+	return words, nil
+}
+
+// A field produced by the word expansions. The pattern of the field is its value
+// with the quoted characters escaped, so they are matched literally by pathname
+// expansion.
+type field struct {
+	Value   string
+	Pattern string
+}
+
+// Expands the expression into fields like expandFields, keeping the pattern of
+// every field.
+func (e *Executor) expandFieldPatterns(node *ast.Expr, env *ExecEnv) ([]field, error) {
+	fields := []field{}
+	value := strings.Builder{}
+	pattern := strings.Builder{}
+	inField := false
+
+	delimit := func() {
+		if inField {
+			fields = append(fields, field{Value: value.String(), Pattern: pattern.String()})
+			value.Reset()
+			pattern.Reset()
+			inField = false
+		}
+	}
+
+	write := func(s string, quoted bool) {
+		value.WriteString(s)
+
+		if quoted {
+			pattern.WriteString(escapePattern(s))
+		} else {
+			pattern.WriteString(s)
+		}
+	}
+
+	ifs := e.getIFS(env)
+
+	// the unquoted text is split into fields, the first field continues the
+	// current one
+	split := func(text string) {
+		if text == "" {
+			return
+		}
+
+		first, _ := utf8.DecodeRuneInString(text)
+		last, _ := utf8.DecodeLastRuneInString(text)
+
+		if slices.Contains(ifs, first) {
+			delimit()
+		}
+
+		s := e.newFieldSplitScanner(strings.NewReader(text), env)
+		for i := 0; s.Scan(); i++ {
+			if i > 0 {
+				delimit()
+			}
+
+			write(s.Text(), false)
+			inField = true
+		}
+
+		if slices.Contains(ifs, last) {
+			delimit()
+		}
+	}
+
+	b := bytes.Buffer{}
+
+	for _, n := range node.Nodes {
+		b.Reset()
+
+		if q, ok := n.(*ast.DoubleQuote); ok {
+			// "$@" without positional parameters expands to no fields at all
+			if isQuotedAt(q) && len(env.PositionalParams) == 0 {
+				continue
+			}
+
+			inField = true
+
+			for _, qn := range q.Nodes {
+				if p, ok := qn.(*ast.Param); ok && p.Name == "@" && p.Op == ast.ParamOpNone {
+					for i, param := range env.PositionalParams {
+						if i > 0 {
+							delimit()
+							inField = true
+						}
+
+						write(param, true)
+					}
+
+					continue
+				}
+
+				b.Reset()
+				if _, err := e.expandNode(qn, env, &b); err != nil {
+					return nil, err
+				}
+
+				write(b.String(), true)
+			}
+
+			continue
+		}
+
+		// unquoted $@ and $* expand to a field for each positional parameter, each
+		// one split on its own
+		if p, ok := n.(*ast.Param); ok && (p.Name == "@" || p.Name == "*") && p.Op == ast.ParamOpNone {
+			for i, param := range env.PositionalParams {
+				if i > 0 {
+					delimit()
+				}
+
+				split(param)
+			}
+
+			continue
+		}
+
+		if _, err := e.expandNode(n, env, &b); err != nil {
+			return nil, err
+		}
+
+		if _, ok := n.(*ast.String); ok {
+			inField = true
+			write(b.String(), false)
+			continue
+		}
+
+		// quoted strings, and the result of tilde expansion, are not split or used
+		// as patterns. Empty quotes still produce a field (like '').
+		if isQuoteNode(n) {
+			inField = true
+			write(b.String(), true)
+			continue
+		}
+
+		split(b.String())
+	}
+
+	delimit()
+
+	return fields, nil
+}
+
+// Returns whether the double quote contains only $@
+func isQuotedAt(node *ast.DoubleQuote) bool {
+	if len(node.Nodes) != 1 {
+		return false
+	}
+
+	p, ok := node.Nodes[0].(*ast.Param)
+	return ok && p.Name == "@" && p.Op == ast.ParamOpNone
+}
+
+func (e *Executor) newFieldSplitScanner(reader io.Reader, env *ExecEnv) *bufio.Scanner {
+	return utils.NewRunesScanner(reader, e.getIFS(env))
+}
+
+// Returns the separator used to join the positional parameters in $*, the first
+// character of IFS
+func (e *Executor) getIFSSeparator(env *ExecEnv) string {
+	ifs := e.getIFS(env)
+	if len(ifs) == 0 {
+		return ""
+	}
+
+	return string(ifs[0])
 }
 
-func (e *Executor) getIFS() []rune {
-	s := e.ExecEnv.GetParamDefault("IFS", defaultIFS)
+func (e *Executor) getIFS(env *ExecEnv) []rune {
+	s := env.GetParamDefault("IFS", defaultIFS)
 	runes := []rune{}
 	for _, r := range s {
 		runes = append(runes, r)
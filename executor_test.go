@@ -5,7 +5,11 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/omerhorev/gobash/ast"
 	"github.com/omerhorev/gobash/command"
@@ -185,6 +189,175 @@ func TestExecutorIORedirection(t *testing.T) {
 	bufferStderr.Reset()
 }
 
+func TestExecutorIORedirectionTargets(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	bufferStderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&bufferStderr)
+	executor.Settings.FS = fstest.MapFS{"dir/a.log": {}}
+	executor.ExecEnv.WorkingDirectory = "/"
+
+	files := map[string]*bytes.Buffer{
+		"rw": bytes.NewBufferString("abc"),
+	}
+	mockTestFiles(executor, files)
+
+	testScript := newTestScript(t, executor, &b)
+
+	// the targets are expanded
+	executor.ExecEnv.SetParam("dir", "out")
+	executor.ExecEnv.SetParam("x", "a b")
+	testScript(`echo 1 > $dir/1; echo 2 > "$x"; echo 3 > $(echo c)`, "")
+	require.Equal(t, "1\n", files["out/1"].String())
+	require.Equal(t, "2\n", files["a b"].String())
+	require.Equal(t, "3\n", files["c"].String())
+
+	// pathname expansion is performed only by an interactive shell
+	testScript(`echo 4 > dir/*.log`, "")
+	require.Equal(t, "4\n", files["dir/*.log"].String())
+	require.NotContains(t, files, "dir/a.log")
+
+	executor.ExecEnv.Options.Interactive = true
+	testScript(`echo 4 > dir/*.log`, "")
+	require.Equal(t, "4\n", files["dir/a.log"].String())
+	executor.ExecEnv.Options.Interactive = false
+
+	// a target that expands to multiple fields is ambiguous
+	testScript(`echo 5 > $x`, "")
+	require.Equal(t, "io error: ambiguous redirect\n", bufferStderr.String())
+	require.NotContains(t, files, "a")
+	bufferStderr.Reset()
+
+	// n<&- and n>&- close the file descriptor
+	testScript(`echo a; echo b >&-; echo c`, "a\nc\n")
+	testScript(`echo a 2>&- 1>&2`, "")
+	testScript(`cat <&-; echo d`, "d\n")
+
+	// <> does not truncate the file
+	testScript(`true <>rw`, "")
+	require.Equal(t, "abc", files["rw"].String())
+}
+
+func TestExecutorExec(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand)
+
+	files := map[string]*bytes.Buffer{}
+	mockTestFiles(executor, files)
+
+	// without a command, the redirections affect the current environment
+	require.NoError(t, runTestScript(t, executor, "exec 3>log; echo a >&3; echo b >&3"))
+	require.Equal(t, "a\nb\n", files["log"].String())
+	require.NoError(t, runTestScript(t, executor, "echo c >&3; exec 3>&-; echo d >&3"))
+	require.Equal(t, "a\nb\nc\n", files["log"].String())
+	require.Equal(t, "io error: 3: bad file descriptor\n", stderr.String())
+	stderr.Reset()
+
+	// the redirections of exec in a subshell do not affect the shell
+	require.NoError(t, runTestScript(t, executor, "(exec 4>sub; echo e >&4); echo f >&4"))
+	require.Equal(t, "e\n", files["sub"].String())
+	require.Equal(t, "io error: 4: bad file descriptor\n", stderr.String())
+	stderr.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "exec >>out 2>&1; echo g; echo h >&2; x"))
+	require.Equal(t, "g\nh\nx: command not found\n", files["out"].String())
+	require.Empty(t, b.String())
+	require.Empty(t, stderr.String())
+
+	// the files opened by exec are closed once no file descriptor refers to them
+	opened := map[string]*mocks.MockFile{}
+	openFunc := executor.Settings.OpenFunc
+	executor.Settings.OpenFunc = func(path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		f, err := openFunc(path, flag, perm)
+		opened[path] = f.(*mocks.MockFile)
+		return f, err
+	}
+
+	require.NoError(t, runTestScript(t, executor, "exec 3>a 4>b; exec 3>&-; exec 4>c; (exec 5>d; exec 4>&-); exec 6>e 7>&6; exec 6>&-; echo i >&7"))
+	require.True(t, opened["a"].Closed())
+	require.True(t, opened["b"].Closed())
+	require.True(t, opened["d"].Closed())
+	require.Equal(t, "i\n", files["e"].String())
+	require.NoError(t, runTestScript(t, executor, "echo j >&4; exec 7>&-"))
+	require.Equal(t, "j\n", files["c"].String())
+	require.True(t, opened["e"].Closed())
+	require.False(t, opened["c"].Closed())
+	require.Empty(t, stderr.String())
+
+	// with a command, the shell exits with the exit status of the command
+	executor = createTestExecutor()
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand)
+
+	require.Equal(t, ExitError{Status: 0}, runTestScript(t, executor, "exec echo 1; echo 2"))
+	require.Equal(t, ExitError{Status: 1}, runTestScript(t, executor, "f() { echo 3; false; }; x=4 exec f; echo 5"))
+	require.Equal(t, ExitError{Status: 0}, runTestScript(t, executor, "x=6 exec printenv x"))
+	require.Equal(t, ExitError{Status: 127}, runTestScript(t, executor, "exec y; echo 7"))
+	require.NoError(t, runTestScript(t, executor, "(exec false); echo $?"))
+	require.Equal(t, "1\n3\n6\n1\n", b.String())
+	require.Equal(t, "exec: y: command not found\n", stderr.String())
+	stderr.Reset()
+
+	// exec can be removed
+	executor.Settings.NoExec = true
+	require.NoError(t, runTestScript(t, executor, "exec echo 1"))
+	require.Equal(t, "exec: command not found\n", stderr.String())
+}
+
+func TestExecutorNoClobber(t *testing.T) {
+	executor := createTestExecutor()
+	bufferStderr := bytes.Buffer{}
+	executor.SetStderr(&bufferStderr)
+
+	files := map[string]*bytes.Buffer{
+		"file": bytes.NewBufferString("abc"),
+	}
+	mockTestFiles(executor, files)
+
+	// without noclobber, > and >| overwrite the file
+	require.NoError(t, runTestScript(t, executor, `echo 1 > file`))
+	require.Equal(t, "1\n", files["file"].String())
+	require.NoError(t, runTestScript(t, executor, `echo 2 >| file`))
+	require.Equal(t, "2\n", files["file"].String())
+
+	executor.ExecEnv.Options.NoClobber = true
+	require.Equal(t, "C", executor.ExecEnv.Options.Flags())
+
+	require.NoError(t, runTestScript(t, executor, `echo 3 > file`))
+	require.Equal(t, "2\n", files["file"].String())
+	require.Equal(t, "io error: file: cannot overwrite existing file\n", bufferStderr.String())
+	bufferStderr.Reset()
+
+	executor.Settings.StopOnIORedirectionError = true
+	require.ErrorIs(t, runTestScript(t, executor, `echo 3 > file`), newIORedirectionError(errors.New("some error")))
+	bufferStderr.Reset()
+
+	// >| and >> still write to the file, and new files are created
+	require.NoError(t, runTestScript(t, executor, `echo 4 >| file; echo 5 >> file; echo 6 > new`))
+	require.Equal(t, "4\n5\n", files["file"].String())
+	require.Equal(t, "6\n", files["new"].String())
+	require.Empty(t, bufferStderr.String())
+
+	// the files are checked where they are opened, and files that are not regular
+	// files can still be written
+	executor = createTestExecutor()
+	executor.SetStderr(&bufferStderr)
+	dir := t.TempDir()
+	executor.ExecEnv.SetParam("dir", dir)
+
+	require.NoError(t, runTestScript(t, executor, `echo keep > $dir/file; set -C; echo clobbered > $dir/file; echo 1 > /dev/null`))
+	data, err := os.ReadFile(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "keep\n", string(data))
+	require.Equal(t, "io error: "+dir+"/file: cannot overwrite existing file\n", bufferStderr.String())
+}
+
 func TestExecutorBinary(t *testing.T) {
 	executor := createTestExecutor()
 	b := bytes.Buffer{}
@@ -243,6 +416,497 @@ func TestExecutorBinary(t *testing.T) {
 	b.Reset()
 }
 
+func TestExecutorNot(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+
+	require.NoError(t, runTestScript(t, executor, "! true || echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "! false && echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	// the bang applies to the exit status of the whole pipeline
+	require.NoError(t, runTestScript(t, executor, "! false | true || echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "! true | false && echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if ! { false; }; then echo 1; fi; while ! true; do echo 2; done"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "! echo 1 | rev && echo 2"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+}
+
+func TestExecutorBackground(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStdin(strings.NewReader("abc\n"))
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+
+	release := make(chan struct{})
+	executor.AddCommands(
+		&command.SimpleMatchCommand{Name: "block", F: func(s []string, e *command.Env) int {
+			<-release
+			return 0
+		}},
+		&command.SimpleMatchCommand{Name: "status", F: func(s []string, e *command.Env) int {
+			ret, _ := strconv.Atoi(s[1])
+			return ret
+		}},
+	)
+
+	// the job does not block the execution of the script
+	require.NoError(t, runTestScript(t, executor, "{ block; echo 2; } & echo 1"))
+	require.Equal(t, "1\n", b.String())
+	require.Equal(t, 1, executor.jobs.lastBackgroundPid())
+	close(release)
+	require.NoError(t, runTestScript(t, executor, "wait"))
+	require.Equal(t, "1\n2\n", b.String())
+	require.Empty(t, executor.jobs.all())
+	b.Reset()
+
+	// the exit status of the job is reported by wait
+	require.NoError(t, runTestScript(t, executor, "status 3 & wait 2 || echo 1; wait 2 || echo 2"))
+	require.Equal(t, "1\n2\n", b.String())
+	require.Equal(t, "wait: pid 2 is not a child of this shell\n", stderr.String())
+	b.Reset()
+	stderr.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "status 4 & status 0 & wait 3 4 && echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	// the stdin of the job is redirected from a null device
+	require.NoError(t, runTestScript(t, executor, "rev & wait 5; rev"))
+	require.Equal(t, "cba\n", b.String())
+	b.Reset()
+
+	// the job is executed in a copy of the current environment
+	require.NoError(t, runTestScript(t, executor, "for i in 1; do true; done & wait 6"))
+	require.Empty(t, executor.ExecEnv.GetParam("i"))
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "wait x"))
+	require.Equal(t, "wait: x: not a pid or valid job spec\n", stderr.String())
+	stderr.Reset()
+
+	// errors are reported to the stderr of the job, while the shell changes its
+	// own files
+	require.NoError(t, runTestScript(t, executor, "nosuch & echo 1 >/dev/null; echo 2 >/dev/null; wait"))
+	require.Equal(t, "nosuch: command not found\n", stderr.String())
+	stderr.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "{ nosuch; } 2>/dev/null & wait"))
+	require.Empty(t, stderr.String())
+}
+
+func TestExecutorJobControl(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+
+	executor.AddCommands(
+		command.Sleep,
+		&command.SimpleMatchCommand{Name: "block", F: func(s []string, e *command.Env) int {
+			<-e.Done()
+			return 1
+		}},
+		&command.SimpleMatchCommand{Name: "status", F: func(s []string, e *command.Env) int {
+			ret, _ := strconv.Atoi(s[1])
+			return ret
+		}},
+	)
+
+	require.NoError(t, runTestScript(t, executor, "block a & while true; do block b; done & jobs; jobs -l %1; jobs -p %%"))
+	require.Equal(t, "[1] - Running block a\n[2] + Running while true ; do block b ; done\n[1] - 1 Running block a\n2\n", b.String())
+	b.Reset()
+
+	// killing a job cancels its execution
+	require.NoError(t, runTestScript(t, executor, "kill %block; kill -s KILL %?true && kill -0 %1"))
+	jobs := executor.Jobs()
+	require.Len(t, jobs, 2)
+	require.Equal(t, 143, jobs[0].Wait())
+	require.Equal(t, 137, jobs[1].Wait())
+
+	// done jobs are reported once
+	require.NoError(t, runTestScript(t, executor, "jobs; jobs"))
+	require.Equal(t, "[1] - Terminated block a\n[2] + Killed while true ; do block b ; done\n", b.String())
+	require.Empty(t, executor.Jobs())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "status 3 & status 0 & wait %2"))
+	require.Equal(t, 3, executor.Jobs()[0].Wait())
+	require.NoError(t, runTestScript(t, executor, "jobs %1; jobs"))
+	require.Equal(t, "[1] + Done(3) status 3\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "sleep 1h & kill -INT %1; wait %1 || echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	// fg waits for the job
+	require.NoError(t, runTestScript(t, executor, "status 4 & fg || echo 1; fg"))
+	require.Equal(t, "status 4\n1\n", b.String())
+	require.Equal(t, "fg: %: no such job\n", stderr.String())
+	b.Reset()
+	stderr.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "block & bg; bg %2; kill -9 %1; wait; bg %1"))
+	require.Equal(t, "bg: job 1 already in background\n"+"bg: %2: no such job\n"+"bg: %1: no such job\n", stderr.String())
+	stderr.Reset()
+
+	// jobs can be killed by the embedding application
+	require.NoError(t, runTestScript(t, executor, "block &"))
+	jobs = executor.Jobs()
+	require.Len(t, jobs, 1)
+	require.False(t, jobs[0].Done())
+	jobs[0].Kill(SignalHUP)
+	require.Equal(t, 129, jobs[0].Wait())
+	require.True(t, jobs[0].Done())
+	require.NoError(t, runTestScript(t, executor, "jobs"))
+	require.Equal(t, "[1] + Hangup block\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "kill -l; kill -l 143 9; kill -x 1; kill %3; kill"))
+	require.Equal(t, "HUP INT QUIT ABRT KILL ALRM TERM\nTERM\nKILL\n", b.String())
+	require.Equal(t, "kill: x: invalid signal specification\n"+
+		"kill: %3: no such job\n"+
+		"kill: usage: kill [-s sigspec | -signum | -sigspec] pid | jobspec ... or kill -l [sigspec]\n", stderr.String())
+}
+
+func TestExecutorParamExpansion(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand)
+
+	executor.ExecEnv.SetParam("x", "abc")
+	executor.ExecEnv.SetParam("null", "")
+	executor.ExecEnv.SetParam("path", "/usr/local/lib.tar.gz")
+
+	testScript := newTestScript(t, executor, &b)
+
+	testScript("echo $x ${x} a${x}b $x$x $unset-", "abc abc aabcb abcabc -\n")
+	testScript("echo $ x$", "$ x$\n")
+	testScript("echo \\$x", "$x\n")
+	testScript("y=$x printenv y", "abc\n")
+
+	// the results of unquoted expansions are split into fields
+	executor.ExecEnv.SetParam("ws", " a  b ")
+	testScript("echo [$ws] $null $ws$x", "[ a b ] a b abc\n")
+	testScript("y=$ws printenv y", " a  b \n")
+
+	testScript("echo ${#x} ${#null} ${#unset}", "3 0 0\n")
+
+	testScript("echo ${x-d} ${null-d} ${unset-d}", "abc d\n")
+	testScript("echo ${x:-d} ${null:-d} ${unset:-d}", "abc d d\n")
+	testScript("echo ${unset:-$x} ${unset:-${null:-e}}", "abc e\n")
+
+	testScript("echo ${x+d} ${null+d} ${unset+d}", "d d\n")
+	testScript("echo ${x:+d} ${null:+d} ${unset:+d}", "d\n")
+
+	testScript("echo ${x=d} ${null=d} ${a=d}; echo $a", "abc d\nd\n")
+	testScript("echo ${x:=d} ${null:=d} ${b:=d}; echo $null", "abc d d\nd\n")
+	executor.ExecEnv.SetParam("null", "")
+
+	testScript("echo ${path%.*} ${path%%.*}", "/usr/local/lib.tar /usr/local/lib\n")
+	testScript("echo ${path#*/} ${path##*/}", "usr/local/lib.tar.gz lib.tar.gz\n")
+	testScript("echo ${path%x} ${path#/usr} ${x%} ${x#*}", "/usr/local/lib.tar.gz /local/lib.tar.gz abc abc\n")
+	testScript("echo ${path%[.]g?} ${x#?}", "/usr/local/lib.tar bc\n")
+
+	testScript("for i in ${path%%.*} $x; do echo ${i##*/}; done", "lib\nabc\n")
+	testScript("case $x in a*) echo ${x};; esac", "abc\n")
+
+	// the word is expanded only when it is used
+	testScript("echo ${x:-`echo 1 > out`}; echo ${x:-${c:=1}}; printenv c", "abc\nabc\n\n")
+
+	// expansion errors stop the execution
+	err := runTestScript(t, executor, "echo ${x:?}; echo ${null:?}; echo 2")
+	require.True(t, IsExpansionError(err))
+	require.Equal(t, "null: parameter null or not set\n", stderr.String())
+	stderr.Reset()
+
+	err = runTestScript(t, executor, "echo ${unset?is not $x}")
+	require.True(t, IsExpansionError(err))
+	require.Equal(t, "unset: is not abc\n", stderr.String())
+	stderr.Reset()
+
+	err = runTestScript(t, executor, "echo ${1:=a}")
+	require.True(t, IsExpansionError(err))
+	require.Equal(t, "$1: cannot assign in this way\n", stderr.String())
+	stderr.Reset()
+
+	p := parseDefaultText(t, "echo ${x:}")
+	require.True(t, IsSyntaxError(p.Error()))
+}
+
+func TestExecutorArithmetic(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand)
+
+	testScript := newTestScript(t, executor, &b)
+
+	executor.ExecEnv.SetParam("x", "3")
+	testScript("echo $((1 + 2 * 3)) a$((x))b $((x>2?10:20))", "7 a3b 10\n")
+	testScript("echo $(( $x * (x + 1) )) $(($(echo 2) * 2 == 4 ? 1 : 0))", "12 1\n")
+	testScript("echo $(( ${x} << 2 )) $((${unset:-4} - 5))", "12 -1\n")
+	testScript("echo $((x += 2)); echo $x", "5\n5\n")
+	testScript("echo $(( (1) + (2) )) $((1)) $(( ))", "3 1 0\n")
+
+	// counter loops
+	executor.ExecEnv.SetParam("i", "0")
+	testScript("for j in 1 2 3; do echo $((i += j)); done", "1\n3\n6\n")
+
+	err := runTestScript(t, executor, "echo $((1 / (x - 5))); echo after")
+	require.True(t, IsExpansionError(err))
+	require.Equal(t, "1 / (x - 5): division by zero\n", stderr.String())
+}
+
+func TestExecutorPathnameExpansion(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+
+	executor.Settings.FS = fstest.MapFS{
+		"home/a.log":      {},
+		"home/b.log":      {},
+		"home/c.txt":      {},
+		"home/.hidden":    {},
+		"home/.x.log":     {},
+		"home/d/e.log":    {},
+		"home/d/f.txt":    {},
+		"home/g/e.log":    {},
+		"home/*":          {},
+		"tmp/x1":          {},
+		"tmp/x2":          {},
+		"tmp/y[1]":        {},
+		"etc/conf/a.conf": {},
+	}
+	executor.ExecEnv.WorkingDirectory = "/home"
+
+	testScript := newTestScript(t, executor, &b)
+
+	testScript("echo *.log", "a.log b.log\n")
+	testScript("echo ?.txt [ab].log [!a].log", "c.txt a.log b.log b.log\n")
+	testScript("echo *", "* a.log b.log c.txt d g\n")
+	testScript("echo */", "d/ g/\n")
+	testScript("echo */e.log */*.txt", "d/e.log g/e.log d/f.txt\n")
+	testScript("echo .* .x*", ".hidden .x.log .x.log\n")
+	testScript("echo /tmp/x* /tmp/y* /etc/*/*.conf", "/tmp/x1 /tmp/x2 /tmp/y[1] /etc/conf/a.conf\n")
+	testScript("echo ../tmp/x?", "../tmp/x1 ../tmp/x2\n")
+	testScript("for f in d/*; do echo $f; done", "d/e.log\nd/f.txt\n")
+
+	// patterns that match nothing are kept as is
+	testScript("echo *.none /none/* [a", "*.none /none/* [a\n")
+	testScript("echo d/e.log/*", "d/e.log/*\n")
+
+	// the results of unquoted expansions are also expanded
+	executor.ExecEnv.SetParam("p", "*.txt d/*.txt")
+	testScript("echo $p", "c.txt d/f.txt\n")
+
+	// quoted pattern characters match literally
+	fields := executor.expandPathname(field{Value: "*", Pattern: escapePattern("*")}, executor.ExecEnv)
+	require.Equal(t, []string{"*"}, fields)
+
+	q := ast.NewDoubleQuote()
+	q.Nodes = []ast.Node{ast.NewString("y[1]")}
+	words, err := executor.expandWords([]*ast.Expr{ast.NewExpr(ast.NewString("/tmp/"), q)}, executor.ExecEnv)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/tmp/y[1]"}, words)
+
+	q.Nodes = []ast.Node{ast.NewString("*")}
+	words, err = executor.expandWords([]*ast.Expr{ast.NewExpr(ast.NewString("*."), q)}, executor.ExecEnv)
+	require.NoError(t, err)
+	require.Equal(t, []string{"*.*"}, words)
+
+	// set -f disables pathname expansion
+	executor.ExecEnv.Options.NoGlob = true
+	testScript("echo *.log", "*.log\n")
+
+	// with the os file system, relative patterns are matched from the working
+	// directory of the process
+	executor = createTestExecutor()
+	executor.SetStdout(&b)
+	testScript = newTestScript(t, executor, &b)
+	testScript("echo executor_tes*.go", "executor_test.go\n")
+}
+
+func TestExecutorTildeExpansion(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	executor.Settings.HomeDirFunc = func(user string) (string, error) {
+		if user == "bob" {
+			return "/home/bob", nil
+		}
+
+		return "", errors.Errorf("unknown user %s", user)
+	}
+
+	executor.Settings.CdFunc = func(path string) (string, error) {
+		return path, nil
+	}
+
+	testScript := newTestScript(t, executor, &b)
+
+	// without HOME, the tilde-prefix is kept
+	testScript("echo ~ ~/x", "~ ~/x\n")
+
+	executor.ExecEnv.SetParam("HOME", "/home/my user")
+	testScript("echo ~ ~/x ~bob ~bob/x ~alice/x", "/home/my user /home/my user/x /home/bob /home/bob/x ~alice/x\n")
+	testScript("echo a~ a/~ ~$x \\~", "a~ a/~ ~ ~\n")
+	testScript("for d in ~bob ~; do echo $d; done", "/home/bob\n/home/my user\n")
+	testScript("echo ${unset:-~bob}", "/home/bob\n")
+	testScript("echo x$((~0))", "x-1\n")
+
+	// in assignments, tilde-prefixes are also expanded after colons
+	testScript("P=~/bin:~bob/x:a~ printenv P", "/home/my user/bin:/home/bob/x:a~\n")
+	testScript("echo P=~/bin:~bob", "P=~/bin:~bob\n")
+
+	require.NoError(t, runTestScript(t, executor, "cd ~/work"))
+	require.Equal(t, "/home/my user/work", executor.ExecEnv.WorkingDirectory)
+}
+
+func TestExecutorQuoting(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+	executor.Settings.FS = fstest.MapFS{"a": {}, "b": {}}
+	executor.ExecEnv.WorkingDirectory = "/"
+
+	testScript := newTestScript(t, executor, &b)
+
+	executor.ExecEnv.SetParam("x", " 1  2 ")
+	testScript(`echo "a  b" 'a$b' a\ \ b`, "a  b a$b a  b\n")
+	testScript(`echo "[$x]" [$x] '[$x]' \$x`, "[ 1  2 ] [ 1 2 ] [$x] $x\n")
+	testScript(`echo "" '' a"" ""b`, "  a b\n")
+	testScript(`echo "\$x \"\\ \a" '\n'`, "$x \"\\ \\a \\n\n")
+	testScript("echo \"$(echo \"a  b\")\" \"`echo c`\"", "a  b c\n")
+	testScript(`y="$x" printenv y`, " 1  2 \n")
+	testScript(`for i in "a b" 'c d' e\ f; do echo $i; done`, "a b\nc d\ne f\n")
+
+	// quoted characters are not used as patterns
+	testScript(`echo * "*" '*' \* "a"*`, "a b * * * a\n")
+	testScript(`case "*" in "a"*) echo 1;; \*) echo 2;; esac`, "2\n")
+	testScript(`case ab in "a"*) echo 1;; esac`, "1\n")
+	executor.ExecEnv.SetParam("p", "a*")
+	testScript(`y=${p%"*"} printenv y`, "a\n")
+
+	// "$@" expands to a field for each positional parameter
+	executor.ExecEnv.PositionalParams = []string{"a b", "c"}
+	testScript(`for i in "$@"; do echo "<$i>"; done`, "<a b>\n<c>\n")
+	testScript(`for i in "$*"; do echo "<$i>"; done`, "<a b c>\n")
+	testScript(`for i in "x$@y"; do echo "<$i>"; done`, "<xa b>\n<cy>\n")
+	executor.ExecEnv.PositionalParams = []string{}
+	testScript(`for i in "$@"; do echo "<$i>"; done; echo end`, "end\n")
+}
+
+func TestExecutorHereDoc(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testCopyCommand)
+
+	testScript := newTestScript(t, executor, &b)
+
+	executor.ExecEnv.SetParam("x", "1  2")
+	testScript("copy <<EOF\na $x\n\"$x\" '$x' \\$x $((1 + 2))\nEOF\n", "a 1  2\n\"1  2\" '1  2' $x 3\n")
+	testScript("copy <<EOF\n\tEOF\nEOF\necho end\n", "\tEOF\nend\n")
+	testScript("copy <<'EOF'\na $x \\$x\nEOF\n", "a $x \\$x\n")
+	testScript("copy <<\"E\"OF\n$x\nEOF\n", "$x\n")
+	testScript("copy <<\\EOF\n$x\nEOF\n", "$x\n")
+	testScript("copy <<-EOF\n\t\ta\n\tb\n\tEOF\n", "a\nb\n")
+	testScript("copy <<EOF; copy <<EOF2\na\nEOF\nb\nEOF2\n", "a\nb\n")
+	testScript("copy 0<<EOF | rev\nabc\nEOF\n", "cba\n")
+	testScript("copy <<EOF\nline \\\ncontinued\nEOF\n", "line continued\n")
+	testScript("copy <<EOF\nno delimiter", "no delimiter")
+}
+
+func TestExecutorSpecialParams(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	testScript := newTestScript(t, executor, &b)
+
+	testScript("echo $?; false; echo $?; true; echo $?", "0\n1\n0\n")
+	testScript("false | true; echo $?; true | false; echo $?", "0\n1\n")
+	testScript("! true; echo $?; false || echo $?", "1\n1\n")
+	testScript("f() { return 3; }; f; echo $?; f; x=$? printenv x", "3\n3\n")
+	testScript("f() { false; return; }; f; echo $?", "1\n")
+	testScript("if false; then :; fi; echo $?", "0\n")
+
+	executor.ExecEnv.ShellName = "sh"
+	executor.ExecEnv.PositionalParams = []string{"a", "b c", "d", "e", "f", "g", "h", "i", "j", "k"}
+	testScript("echo $0 $# $1 $2 $10 ${10} ${11}-", "sh 10 a b c a0 k -\n")
+	testScript("echo ${#@} ${#*} ${#1}", "10 10 1\n")
+	testScript("f() { echo $# $1 $2; }; f x y; echo $1", "2 x y\na\n")
+
+	executor.ExecEnv.PositionalParams = []string{"a", "b c"}
+	testScript("for i in $@; do echo $i; done", "a\nb\nc\n")
+
+	// unquoted, $@ and $* expand to a field for each parameter, then each one is
+	// split on its own
+	testScript(`IFS=:; for i in $@ x$*y; do echo "<$i>"; done; IFS=; for i in $@; do echo "<$i>"; done; unset IFS`, "<a>\n<b c>\n<xa>\n<b cy>\n<a>\n<b c>\n")
+	testScript("echo $$", strconv.Itoa(os.Getpid())+"\n")
+	testScript("echo [$-]", "[]\n")
+	executor.ExecEnv.Options.Interactive = true
+	testScript("echo $-", "i\n")
+	testScript("echo ${!-none}; true & wait; echo $!", "none\n1\n")
+
+	// inside double quotes, $@ expands to a field for every parameter while $*
+	// expands to a single field joined with the first character of IFS
+	quoted := func(nodes ...ast.Node) *ast.Expr {
+		q := ast.NewDoubleQuote()
+		q.Nodes = nodes
+		return ast.NewExpr(q)
+	}
+
+	testFields := func(expr *ast.Expr, expected ...string) {
+		fields, err := executor.expandFields(expr, executor.ExecEnv)
+		require.NoError(t, err)
+		require.Equal(t, expected, fields)
+	}
+
+	testFields(quoted(ast.NewParam("@")), "a", "b c")
+	testFields(quoted(ast.NewString("<"), ast.NewParam("@"), ast.NewString(">")), "<a", "b c>")
+	testFields(quoted(ast.NewParam("*")), "a b c")
+	testFields(quoted(), "")
+
+	executor.ExecEnv.SetParam("IFS", "-")
+	testFields(quoted(ast.NewParam("*")), "a-b c")
+	executor.ExecEnv.SetParam("IFS", "")
+	testFields(quoted(ast.NewParam("*")), "ab c")
+
+	executor.ExecEnv.PositionalParams = []string{}
+	testFields(quoted(ast.NewParam("@")), []string{}...)
+	testFields(quoted(ast.NewParam("*")), "")
+}
+
 func TestExecutorFieldSplitting(t *testing.T) {
 	executor := createTestExecutor()
 	bufferStdout := bytes.Buffer{}
@@ -288,6 +952,41 @@ func TestExecutorExpander(t *testing.T) {
 	require.Equal(t, "hello\n", bufferStdout.String())
 }
 
+func TestExecutorCommandSubstitution(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand, testCopyCommand)
+
+	testScript := newTestScript(t, executor, &b)
+
+	testScript("echo $(echo a b)", "a b\n")
+	testScript("e$(echo ch)o h$(echo ell)o", "hello\n")
+	testScript("echo $(echo a $(echo b $(echo c)))", "a b c\n")
+	testScript("echo $(echo a `echo b`) `echo $(echo c)`", "a b c\n")
+	testScript("echo $( (echo a; echo b) )", "a b\n")
+	testScript("echo $(for i in 1 2; do echo $i; done)", "1 2\n")
+	testScript("echo $(case x in x) echo a;; *) echo b;; esac)", "a\n")
+	testScript("echo \"$(case x in\n(y) echo a;;\nx) echo b;;\nesac)\"", "b\n")
+	testScript("echo $(echo a # comment )\n)", "a\n")
+	testScript("echo \"$(copy <<X\nheredoc)in\nX\n)\"", "heredoc)in\n")
+
+	// the trailing newlines are removed, the other newlines are kept
+	testScript("x=$(echo; echo a; echo; echo b; echo; echo) printenv x", "\na\n\nb\n")
+	testScript("x=$(echo) printenv x", "\n")
+
+	// the program is executed in a subshell environment
+	testScript("echo $(f() { echo in; }; f); f", "in\n")
+	require.NotEmpty(t, stderr.String())
+	stderr.Reset()
+
+	// errors that stop the program only set the exit status of the substitution
+	testScript("x=$(echo ${y?msg}; echo a); echo continues \"$x\" $?", "continues  127\n")
+	require.Equal(t, "y: msg\n", stderr.String())
+}
+
 func TestExecutorBuiltinCd(t *testing.T) {
 	executor := createTestExecutor()
 	bufferStdout := bytes.Buffer{}
@@ -323,15 +1022,15 @@ func TestExecutorBuiltinCd(t *testing.T) {
 	}}
 
 	require.NoError(t, executor.Run(prog1))
-	require.Equal(t, "cd: unknown path ", bufferStderr.String())
+	require.Equal(t, "cd: unknown path \n", bufferStderr.String())
 	bufferStderr.Reset()
 
 	require.NoError(t, executor.Run(prog2))
-	require.Equal(t, "cd: unknown path /bad", bufferStderr.String())
+	require.Equal(t, "cd: unknown path /bad\n", bufferStderr.String())
 	bufferStderr.Reset()
 
 	require.NoError(t, executor.Run(prog3))
-	require.Equal(t, "cd: too many arguments", bufferStderr.String())
+	require.Equal(t, "cd: too many arguments\n", bufferStderr.String())
 	bufferStderr.Reset()
 }
 
@@ -343,6 +1042,9 @@ func TestExecutorEnv(t *testing.T) {
 	executor.SetStderr(&bufferStderr)
 	executor.ExecEnv.SetParam("X", "Y")
 	executor.ExecEnv.SetParam("C", "D")
+	executor.ExecEnv.SetParam("Z", "W")
+	executor.ExecEnv.Exported["X"] = true
+	executor.ExecEnv.Exported["C"] = true
 
 	prog1 := &ast.Program{Commands: []ast.Node{
 		&ast.SimpleCommand{Word: ast.NewExprStr("env"), Assignments: map[string]*ast.Expr{"A": ast.NewExprStr("B"), "C": ast.NewExprStr("E")}},
@@ -361,6 +1063,607 @@ func TestExecutorEnv(t *testing.T) {
 	require.Len(t, lines, 3)
 }
 
+func TestExecutorVariables(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+	executor.AddCommands(testPrintenvCommand)
+
+	testScript := newTestScript(t, executor, &b)
+
+	// assignments without a command name set shell variables, which are not
+	// exported unless they are marked by export
+	testScript("x=1; y=\"a b\" z=$x; echo $x $y $z; printenv x y", "1 a b 1\n\n\n")
+	testScript("export x; printenv x; y=2 printenv y; echo $y", "1\n2\na b\n")
+	testScript("export w=3 v; v=4; printenv w v", "3\n4\n")
+	testScript("(export u=5; printenv u); printenv u", "5\n\n")
+	testScript("export -p", "export v=4\nexport w=3\nexport x=1\n")
+	testScript("export t; export", "export t\nexport v=4\nexport w=3\nexport x=1\n")
+
+	// the exit status is the one of the last command substitution
+	testScript("x=$(false); echo $?; x=$(true) y=1; echo $?; false; x=1; echo $?", "1\n0\n0\n")
+	testScript("if x=$(false); then echo 1; else echo 2; fi", "2\n")
+
+	// assignments before special built-ins affect the current environment
+	testScript("s=1 export x; echo $s; r=1 true; echo $r", "1\n\n")
+
+	// read-only variables cannot be assigned or unset
+	testScript("readonly r=1 q; readonly -p; echo $r", "readonly q\nreadonly r=1\n1\n")
+	require.ErrorIs(t, runTestScript(t, executor, "r=2"), newAssignmentError(errors.New("")))
+	require.ErrorIs(t, runTestScript(t, executor, "r=2 true"), newAssignmentError(errors.New("")))
+	require.ErrorIs(t, runTestScript(t, executor, "r=2 export y"), newAssignmentError(errors.New("")))
+	require.ErrorIs(t, runTestScript(t, executor, "for r in 1; do true; done"), newAssignmentError(errors.New("")))
+	require.ErrorIs(t, runTestScript(t, executor, "echo $((r = 2))"), newAssignmentError(errors.New("")))
+	require.Equal(t, "r: readonly variable\nr: readonly variable\nr: readonly variable\nr: readonly variable\nr = 2: r: readonly variable\n", stderr.String())
+	stderr.Reset()
+
+	testScript("export r=2; echo $?; unset r; echo $? $r", "1\n1 1\n")
+	require.Equal(t, "export: r: readonly variable\nunset: r: readonly variable\n", stderr.String())
+	stderr.Reset()
+
+	testScript("unset r; echo \"u=$?\"", "u=1\n")
+	require.Equal(t, "unset: r: readonly variable\n", stderr.String())
+	stderr.Reset()
+
+	// unset removes variables and functions
+	testScript("unset x v; echo $x$v; printenv x w", "\n\n3\n")
+	testScript("f() { echo f; }; unset f; f; unset -f f; f", "f\n")
+	testScript("export 1x; echo $?", "1\n")
+	require.Equal(t, "f: command not found\nexport: 1x: not a valid identifier\n", stderr.String())
+}
+
+func TestExecutorSet(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+
+	testScript := newTestScript(t, executor, &b)
+
+	// options are set by their flags or names, and reported by $-
+	testScript("set -eu -C; echo $-; set +eu -o xtrace +C; echo $-; set +o xtrace -f; echo $-", "Ceu\nx\nf\n")
+	stderr.Reset()
+	testScript("set +f -o pipefail; set -o", "noclobber       off\nerrexit         off\nnoglob          off\nnoexec          off\nnounset         off\nverbose         off\nxtrace          off\npipefail        on\n")
+	testScript("set +o", "set +o noclobber\nset +o errexit\nset +o noglob\nset +o noexec\nset +o nounset\nset +o verbose\nset +o xtrace\nset -o pipefail\n")
+	testScript("set +o pipefail -k; echo $?; set -o nothing; echo $?", "2\n2\n")
+	require.Equal(t, "set: -k: invalid option\nset: nothing: invalid option name\n", stderr.String())
+	stderr.Reset()
+
+	// the options of subshell environments and jobs do not affect the shell
+	testScript("(set -e; false; echo 1); echo $?; x=$(set -x); set -u & wait; echo \"$-\"; false; echo 2", "1\n\n2\n")
+	require.Empty(t, stderr.String())
+
+	// the remaining arguments replace the positional parameters
+	testScript("set a 'b c'; echo $# $2; set -- -d; echo $# $1; set --; echo $#", "2 b c\n1 -d\n0\n")
+
+	// without arguments, the variables are listed
+	executor = createTestExecutor()
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+	testScript = newTestScript(t, executor, &b)
+	testScript("x=1 y='a b'; set", "x=1\ny='a b'\n")
+}
+
+func TestExecutorErrExit(t *testing.T) {
+	b := bytes.Buffer{}
+
+	testScript := func(script string, expected string, exit bool) {
+		executor := createTestExecutor()
+		executor.SetStdout(&b)
+		executor.ExecEnv.Options.ErrExit = true
+
+		b.Reset()
+		err := runTestScript(t, executor, script)
+		if exit {
+			require.ErrorIs(t, err, ExitError{}, script)
+		} else {
+			require.NoError(t, err, script)
+		}
+		require.Equal(t, expected, b.String(), script)
+	}
+
+	testScript("echo 1; false; echo 2", "1\n", true)
+	testScript("echo 1 | false; echo 2", "", true)
+	testScript("(false); echo 2", "", true)
+	testScript("{ false; }; echo 2", "", true)
+	testScript("f() { false; echo 1; }; f; echo 2", "", true)
+
+	// the failure of conditions, of && and || lists (except their last command)
+	// and of negated pipelines does not exit the shell
+	testScript("if false; then echo 1; fi; echo 2", "2\n", false)
+	testScript("while false; do echo 1; done; until true; do echo 1; done; echo 2", "2\n", false)
+	testScript("false && echo 1; false || echo 2; ! true; echo 3", "2\n3\n", false)
+	testScript("false | true; echo $(false; echo 1) 2", "2\n", false)
+	testScript("true && false; echo 1", "", true)
+
+	// the exceptions apply to the commands executed within them
+	testScript("(false; echo 1) || echo 2; if f() { false; echo 3; }; f; then echo 4; fi", "1\n3\n4\n", false)
+	testScript("if true | { false; echo 1; }; then echo 2; fi", "1\n2\n", false)
+
+	// the commands of a pipeline are executed in subshell environments, which
+	// exit on their own failures
+	testScript("true | { false; echo 1; }; echo 2", "", true)
+	testScript("{ false; echo 1; } | true; echo 2", "2\n", false)
+}
+
+func TestExecutorExit(t *testing.T) {
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	testScript := func(script string, expected string, status int) {
+		executor := createTestExecutor()
+		executor.SetStdout(&b)
+		executor.SetStderr(&stderr)
+
+		b.Reset()
+		err := runTestScript(t, executor, script)
+		require.Equal(t, ExitError{Status: status}, err, script)
+		require.Equal(t, status, executor.ExecEnv.Status, script)
+		require.Equal(t, expected, b.String(), script)
+	}
+
+	testScript("echo 1; exit 3; echo 2", "1\n", 3)
+	testScript("false; exit", "", 1)
+	testScript("for i in 1 2; do while true; do echo $i; exit 4; done; done", "1\n", 4)
+	testScript("f() { echo f; exit 5; echo 1; }; f; echo 2", "f\n", 5)
+	testScript("if true; then exit 6; fi", "", 6)
+
+	// exiting a subshell environment exits only the subshell
+	testScript("(exit 2; echo 1); echo $?; x=$(echo 2; exit 3); echo $? $x; exit 4 | echo 3; exit", "2\n3 2\n3\n", 0)
+
+	// an invalid exit status exits with 2
+	testScript("exit x; echo 1", "", 2)
+	testScript("exit 1 2; echo $?; exit 256", "1\n", 2)
+	require.Equal(t, "exit: x: numeric argument required\nexit: too many arguments\nexit: 256: numeric argument required\n", stderr.String())
+
+	// the exit status of the last command is kept without exiting
+	executor := createTestExecutor()
+	require.NoError(t, runTestScript(t, executor, "true; false"))
+	require.Equal(t, 1, executor.ExecEnv.Status)
+}
+
+func TestExecutorOptions(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+
+	testScript := newTestScript(t, executor, &b)
+
+	// nounset
+	executor.ExecEnv.Options.NoUnset = true
+	testScript("x=1; echo $x ${y-a} ${y:+b} ${y=c} $# $@", "1 a c 0\n")
+	require.ErrorIs(t, runTestScript(t, executor, "echo $z"), newExpansionError(errors.New("")))
+	require.Equal(t, "z: parameter not set\n", stderr.String())
+	executor.ExecEnv.Options.NoUnset = false
+	stderr.Reset()
+
+	// pipefail
+	testScript("false | true; echo $?; set -o pipefail; false | true; echo $?", "0\n1\n")
+	testScript("true | (false) | true; echo $?", "1\n")
+	executor.ExecEnv.Options.PipeFail = false
+
+	// noexec
+	testScript("echo 1; set -n; echo 2; set +n; echo 3", "1\n")
+}
+
+func TestExecutorXTrace(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+
+	testScript := func(script string, expected string, expectedTrace string) {
+		b.Reset()
+		stderr.Reset()
+		require.NoError(t, runTestScript(t, executor, script), script)
+		require.Equal(t, expected, b.String(), script)
+		require.Equal(t, expectedTrace, stderr.String(), script)
+	}
+
+	// the expanded command is traced, quoted so it can be reinput to the shell
+	testScript("set -x; x='a b' y=; echo $x \"it's\" > /dev/null", "", "+ x='a b' y=''\n+ echo a b 'it'\\''s'\n")
+	testScript("z=1 echo $(echo 1); set +x", "1\n", "+ echo 1\n+ z=1 echo 1\n+ set +x\n")
+
+	// PS4 is expanded before each trace, without tracing its own expansion
+	testScript("PS4='$x$(echo -) '; set -x; true; set +x", "", "a b- true\na b- set +x\n")
+
+	// the trace is passed to the trace func instead of being written to stderr
+	traces := []string{}
+	executor.Settings.TraceFunc = func(trace Trace) {
+		traces = append(traces, trace.String())
+	}
+
+	testScript("set -x; for i in 1 2; do a=$i echo $i; done", "1\n2\n", "")
+	require.Equal(t, []string{"a=1 echo 1", "a=2 echo 2"}, traces)
+}
+
+func TestExecutorIf(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+
+	require.NoError(t, runTestScript(t, executor, "if true; then echo 1; else echo 2; fi"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if false; then echo 1; else echo 2; fi"))
+	require.Equal(t, "2\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if false; then echo 1; elif true; then echo 2; else echo 3; fi"))
+	require.Equal(t, "2\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if false; then echo 1; elif false; then echo 2; else echo 3; fi"))
+	require.Equal(t, "3\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if true; false; then echo 1; fi"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if false; then echo 1; fi || echo 2"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "if true; then false; fi || echo 2"))
+	require.Equal(t, "2\n", b.String())
+	b.Reset()
+}
+
+func TestExecutorLoops(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+
+	// succeeds the first n times it is called, then fails and resets
+	counter := 0
+	executor.AddCommands(&command.SimpleMatchCommand{
+		Name: "count",
+		F: func(args []string, e *command.Env) int {
+			if counter++; counter <= 3 {
+				return 0
+			}
+
+			counter = 0
+			return 1
+		},
+	})
+
+	require.NoError(t, runTestScript(t, executor, "while count; do echo a; done"))
+	require.Equal(t, "a\na\na\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "until true; do echo a; done"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "until false; do echo a; break; echo b; done; echo c"))
+	require.Equal(t, "a\nc\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "while count; do if true; then continue; fi; echo a; done; echo b"))
+	require.Equal(t, "b\n", b.String())
+	b.Reset()
+
+	// the exit status of a loop that continued is the one of continue
+	require.NoError(t, runTestScript(t, executor, "while count; do false; continue; done; echo $?; until true; do :; done; echo $?"))
+	require.Equal(t, "0\n0\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "until ! count; do false; continue; done; echo $?"))
+	require.Equal(t, "0\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "while true; do while true; do echo a; break 2; done; echo b; done; echo c"))
+	require.Equal(t, "a\nc\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "while count; do while true; do echo a; continue 2; done; echo b; done"))
+	require.Equal(t, "a\na\na\n", b.String())
+	b.Reset()
+
+	// more loops than there are enclosing loops exits the outermost loop
+	require.NoError(t, runTestScript(t, executor, "while true; do break 10; done; echo a"))
+	require.Equal(t, "a\n", b.String())
+	b.Reset()
+
+	// break outside of a loop is ignored
+	require.NoError(t, runTestScript(t, executor, "break; echo a"))
+	require.Equal(t, "a\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "while false; do echo a; done || echo b"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "while count; do false; done || echo b"))
+	require.Equal(t, "b\n", b.String())
+	b.Reset()
+}
+
+func TestExecutorFor(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	require.NoError(t, runTestScript(t, executor, "for i in a b c; do echo $i; done"))
+	require.Equal(t, "a\nb\nc\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in; do echo $i; done"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	// the results of expansions are split into fields
+	require.NoError(t, runTestScript(t, executor, "for i in `echo a b` c`echo d`; do echo $i; done"))
+	require.Equal(t, "a\nb\ncd\n", b.String())
+	b.Reset()
+
+	executor.ExecEnv.SetParam("IFS", ":\n")
+	executor.ExecEnv.SetParam("X", "a:b:")
+	require.NoError(t, runTestScript(t, executor, "for i in `echo \"$X\"`c; do echo $i; done"))
+	require.Equal(t, "a\nb\nc\n", b.String())
+	delete(executor.ExecEnv.Params, "IFS")
+	b.Reset()
+
+	executor.ExecEnv.PositionalParams = []string{"x y", "z"}
+	require.NoError(t, runTestScript(t, executor, "for i; do echo \"$i\"; done"))
+	require.Equal(t, "x y\nz\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in a b c; do if true; then continue; fi; echo x; done"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in a; do continue; done; echo $?; for i in a b; do false; continue 1; done; echo $?"))
+	require.Equal(t, "0\n0\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in a b c; do for j in d e; do echo $i; echo $j; break 2; done; done"))
+	require.Equal(t, "a\nd\n", b.String())
+	b.Reset()
+}
+
+func TestExecutorCase(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	script := `
+for i in start stop restart --verbose x.go ab.go other; do
+	case $i in
+		start|stop) echo 1 ;;
+		restart)
+			echo 2
+			;;
+		(-[-a-z]*) echo 3;;
+		?.go) echo 4;;
+		*) echo 5
+	esac
+done`
+
+	require.NoError(t, runTestScript(t, executor, script))
+	require.Equal(t, "1\n1\n2\n3\n4\n5\n5\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "case a in b) echo 1;; esac"))
+	require.Equal(t, "", b.String())
+	b.Reset()
+
+	// only the first matching item is executed
+	require.NoError(t, runTestScript(t, executor, "case a in a) echo 1;; a) echo 2;; esac"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "case a in a) false;; esac || echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "false; case a in b) ;; esac && echo 1"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+}
+
+func TestExecutorGroups(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	files := map[string]*bytes.Buffer{}
+	mockTestFiles(executor, files)
+
+	executor.Settings.CdFunc = func(path string) (string, error) { return path, nil }
+
+	// brace groups are executed in the current environment
+	require.NoError(t, runTestScript(t, executor, "{ for i in a; do cd /a; done; }; echo $i"))
+	require.Equal(t, "a\n", b.String())
+	require.Equal(t, "/a", executor.ExecEnv.WorkingDirectory)
+	b.Reset()
+
+	// subshells are executed in a copy of the current environment
+	require.NoError(t, runTestScript(t, executor, "(for i in b; do cd /b; done; echo $i); echo $i"))
+	require.Equal(t, "b\na\n", b.String())
+	require.Equal(t, "/a", executor.ExecEnv.WorkingDirectory)
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "{ echo 1; echo 2 | rev; } > out1; echo 3"))
+	require.Equal(t, "3\n", b.String())
+	require.Equal(t, "1\n2\n", files["out1"].String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "(echo 1; (echo 2)) > out2 && echo 3"))
+	require.Equal(t, "3\n", b.String())
+	require.Equal(t, "1\n2\n", files["out2"].String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in 1 2; do echo $i; done > out3"))
+	require.Equal(t, "", b.String())
+	require.Equal(t, "1\n2\n", files["out3"].String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "{ echo 1; echo 2; } | rev"))
+	require.Equal(t, "1\n2\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "(false) || { true && echo 1; }"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	// errors that stop a subshell only set its exit status
+	executor.SetStderr(io.Discard)
+	require.NoError(t, runTestScript(t, executor, "readonly R=1; (R=2; echo 1); echo $?; (echo ${y?}; echo 2); echo $?"))
+	require.Equal(t, "127\n127\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "for i in 1 2; do (break); echo $i; done; f() { (return 3); echo $?; }; f"))
+	require.Equal(t, "1\n2\n3\n", b.String())
+	b.Reset()
+
+	// the default cd does not change the working directory of the process, so
+	// subshells and jobs change their own working directory only. Relative paths
+	// are opened from the working directory of the environment
+	executor = createTestExecutor()
+	executor.SetStdout(&b)
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	executor.ExecEnv.SetParam("dir", dir)
+
+	require.NoError(t, runTestScript(t, executor, "cd $dir; (cd sub); cd sub & wait; echo 1 > f; (cd sub; echo 2 > f); echo *; cd sub; cat f; echo; cd ../f; cd x"))
+	require.Equal(t, "f sub\n2\n", b.String())
+	require.Equal(t, "cd: chdir "+dir+"/f: not a directory\ncd: stat "+dir+"/sub/x: no such file or directory\n", stderr.String())
+	require.Equal(t, filepath.Join(dir, "sub"), executor.ExecEnv.WorkingDirectory)
+	data, err := os.ReadFile(filepath.Join(dir, "f"))
+	require.NoError(t, err)
+	require.Equal(t, "1\n", string(data))
+
+	current, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t, wd, current)
+}
+
+func TestExecutorAlias(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.SetStderr(&stderr)
+
+	// each line is parsed after the previous one is executed, like in an
+	// interactive shell, so aliases take effect on the next line
+	testScript := func(script string, expected string) {
+		b.Reset()
+		for _, line := range strings.Split(script, "\n") {
+			tokens, err := NewTokenizerShort(line).ReadAll()
+			require.NoError(t, err)
+
+			p := NewParser(tokens, ParserSettings{Aliases: executor.ExecEnv.Aliases})
+			require.NoError(t, p.Parse(), line)
+			require.NoError(t, executor.Run(p.Program()), line)
+		}
+
+		require.Equal(t, expected, b.String(), script)
+	}
+
+	testScript("alias say='echo said' rr=rev\nsay hi | rr", "ih dias\n")
+	testScript("alias say rr", "say='echo said'\nrr=rev\n")
+	testScript(`alias e='echo ' q="it\'s"`+"\ne q", "it's\n")
+	testScript("alias", `e='echo '`+"\n"+`q='it\'\''s'`+"\nrr=rev\nsay='echo said'\n")
+
+	// an alias defined on a line takes effect on the next line only
+	testScript("alias x='echo x'; x; echo $?\nx", "127\nx\n")
+
+	testScript("unalias say q\nalias", "e='echo '\nrr=rev\nx='echo x'\n")
+	testScript("alias say; echo $?; unalias say; echo $?", "1\n1\n")
+	require.Equal(t, "x: command not found\nalias: say: not found\nunalias: say: not found\n", stderr.String())
+
+	// aliases defined in a subshell are not visible to the parent
+	testScript("(alias y=true); unalias -a\nalias", "")
+	require.Empty(t, executor.ExecEnv.Aliases)
+}
+
+func TestExecutorFunctions(t *testing.T) {
+	executor := createTestExecutor()
+	b := bytes.Buffer{}
+	executor.SetStdout(&b)
+	executor.AddCommands(testPrintenvCommand)
+
+	files := map[string]*bytes.Buffer{}
+	mockTestFiles(executor, files)
+
+	require.NoError(t, runTestScript(t, executor, "f() { echo 1; echo 2; }; f; f"))
+	require.Equal(t, "1\n2\n1\n2\n", b.String())
+	b.Reset()
+
+	// functions have priority over registered commands
+	require.NoError(t, runTestScript(t, executor, "echo() { printenv x; }; x=2 echo 1"))
+	require.Equal(t, "2\n", b.String())
+	delete(executor.ExecEnv.Functions, "echo")
+	b.Reset()
+
+	// positional parameters are scoped to the invocation
+	executor.ExecEnv.PositionalParams = []string{"x", "y"}
+	require.NoError(t, runTestScript(t, executor, "f() { for i; do echo $i; done; }; f a b; for i; do echo $i; done"))
+	require.Equal(t, "a\nb\nx\ny\n", b.String())
+	require.Equal(t, []string{"x", "y"}, executor.ExecEnv.PositionalParams)
+	b.Reset()
+
+	// functions are executed in the current environment
+	require.NoError(t, runTestScript(t, executor, "f() { for j in 1; do true; done; }; f; echo $j"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+
+	// assignments are in effect only during the invocation
+	require.NoError(t, runTestScript(t, executor, "f() { printenv k; }; k=1 f; printenv k"))
+	require.Equal(t, "1\n\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "f() { echo 1; return; echo 2; }; f && echo 3"))
+	require.Equal(t, "1\n3\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "f() { for i in 1 2; do while true; do return 3; done; done; echo 4; }; f || echo 5"))
+	require.Equal(t, "5\n", b.String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "f() { echo 1; } > out; f; echo 2"))
+	require.Equal(t, "2\n", b.String())
+	require.Equal(t, "1\n", files["out"].String())
+	b.Reset()
+
+	require.NoError(t, runTestScript(t, executor, "g() { echo 1; }; g > out2; echo 2"))
+	require.Equal(t, "2\n", b.String())
+	require.Equal(t, "1\n", files["out2"].String())
+	b.Reset()
+
+	// functions defined in a subshell are not visible outside of it
+	stderr := bytes.Buffer{}
+	executor.SetStderr(&stderr)
+	require.NoError(t, runTestScript(t, executor, "(h() { echo 1; }; h); h"))
+	require.Equal(t, "1\n", b.String())
+	require.Equal(t, "h: command not found\n", stderr.String())
+	b.Reset()
+
+	// return outside of a function stops the execution
+	require.NoError(t, runTestScript(t, executor, "echo 1; return 2; echo 3"))
+	require.Equal(t, "1\n", b.String())
+	b.Reset()
+}
+
 func createTestExecutor() *Executor {
 	e := NewExecutor(ExecutorSettings{})
 	e.AddCommands(command.Default...)
@@ -368,6 +1671,66 @@ func createTestExecutor() *Executor {
 	return e
 }
 
+// prints the values of the environment variables provided
+var testPrintenvCommand = &command.SimpleMatchCommand{
+	Name: "printenv",
+	F: func(args []string, e *command.Env) int {
+		for _, arg := range args[1:] {
+			e.Println(e.Env[arg])
+		}
+
+		return 0
+	},
+}
+
+// copies stdin to stdout as is
+var testCopyCommand = &command.SimpleMatchCommand{
+	Name: "copy",
+	F: func(args []string, e *command.Env) int {
+		if _, err := io.Copy(e.Stdout(), e.Stdin()); err != nil {
+			return 1
+		}
+
+		return 0
+	},
+}
+
+// Makes the executor open the files of the map instead of the files of the file
+// system. Like os.OpenFile, missing files are created only with os.O_CREATE, and
+// existing files are not opened with os.O_EXCL.
+func mockTestFiles(executor *Executor, files map[string]*bytes.Buffer) {
+	executor.Settings.OpenFunc = func(path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		if _, exists := files[path]; !exists {
+			if flag&os.O_CREATE == 0 {
+				return nil, os.ErrNotExist
+			}
+
+			files[path] = &bytes.Buffer{}
+		} else if flag&os.O_EXCL != 0 {
+			return nil, os.ErrExist
+		}
+
+		return mocks.NewMockFile(flag, perm, files[path]), nil
+	}
+}
+
+// Returns a function that runs a script with the executor and checks its output,
+// which the executor writes to b
+func newTestScript(t *testing.T, executor *Executor, b *bytes.Buffer) func(script string, expected string) {
+	return func(script string, expected string) {
+		b.Reset()
+		require.NoError(t, runTestScript(t, executor, script), script)
+		require.Equal(t, expected, b.String(), script)
+	}
+}
+
+func runTestScript(t *testing.T, executor *Executor, script string) error {
+	p := parseDefaultText(t, script)
+	require.NoError(t, p.Error())
+
+	return executor.Run(p.Program())
+}
+
 func testBacktickEcho(args ...string) ast.Node {
 	args2 := []*ast.Expr{}
 	for _, arg := range args {
@@ -1,6 +1,8 @@
 package gobash
 
 import (
+	"errors"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/omerhorev/gobash/ast"
@@ -22,15 +24,40 @@ func (t ExpanderToken) String() string {
 }
 
 var (
-	expanderTokenBacktick  = ExpanderToken('`')
-	expanderTokenBackslash = ExpanderToken('\\')
-	expanderTokenEOF       = ExpanderToken(utf8.MaxRune)
+	expanderTokenBacktick   = ExpanderToken('`')
+	expanderTokenBackslash  = ExpanderToken('\\')
+	expanderTokenDollar     = ExpanderToken('$')
+	expanderTokenLParen     = ExpanderToken('(')
+	expanderTokenRParen     = ExpanderToken(')')
+	expanderTokenLBrace     = ExpanderToken('{')
+	expanderTokenRBrace     = ExpanderToken('}')
+	expanderTokenNumberSign = ExpanderToken('#')
+	expanderTokenColon      = ExpanderToken(':')
+	expanderTokenPercent    = ExpanderToken('%')
+	expanderTokenApostrophe = ExpanderToken('\'')
+	expanderTokenQuotation  = ExpanderToken('"')
+	expanderTokenTilde      = ExpanderToken('~')
+	expanderTokenSlash      = ExpanderToken('/')
+	expanderTokenEOF        = ExpanderToken(utf8.MaxRune)
+)
+
+// The special parameters (see 2.5.2 Special Parameters)
+const specialParams = "@*#?-$!0"
+
+// Where tilde-prefixes are recognized in the expression (see 2.6.1 Tilde Expansion)
+type tildeMode int
+
+const (
+	tildeWord       tildeMode = iota // at the start of the word
+	tildeAssignment                  // at the start of the word and after colons
+	tildeNone                        // nowhere
 )
 
 // A helper structure used to parse the syntax of word expansion
 type Expander struct {
-	rdp  rdp.RDP[ExpanderToken, ExpanderToken]
-	Expr *ast.Expr
+	rdp   rdp.RDP[ExpanderToken, ExpanderToken]
+	tilde tildeMode
+	Expr  *ast.Expr
 }
 
 // Creates a new expander object
@@ -39,10 +66,20 @@ func NewExpander(expression string) *Expander {
 		rdp: rdp.RDP[ExpanderToken, ExpanderToken]{
 			Tokens: append([]ExpanderToken(expression), expanderTokenEOF),
 		},
-		Expr: nil,
+		tilde: tildeWord,
+		Expr:  nil,
 	}
 }
 
+// Creates a new expander object for the value of a variable assignment, in which
+// tilde-prefixes are also recognized after colons (like `PATH=~/bin:~/x`)
+func NewAssignmentExpander(expression string) *Expander {
+	e := NewExpander(expression)
+	e.tilde = tildeAssignment
+
+	return e
+}
+
 func (e *Expander) Parse() error {
 	expr := ast.NewExpr()
 	for {
@@ -54,7 +91,27 @@ func (e *Expander) Parse() error {
 			break
 		}
 
-		if node, ok := e.backtick(); ok {
+		if node, ok := e.tildePrefix(); ok {
+			expr.Nodes = append(expr.Nodes, node)
+			continue
+		}
+
+		if node, ok := e.singleQuote(); ok {
+			expr.Nodes = append(expr.Nodes, node)
+			continue
+		}
+
+		if node, ok := e.doubleQuote(); ok {
+			expr.Nodes = append(expr.Nodes, node)
+			continue
+		}
+
+		if node, ok := e.escaped(); ok {
+			expr.Nodes = append(expr.Nodes, node)
+			continue
+		}
+
+		if node, ok := e.expansion(); ok {
 			expr.Nodes = append(expr.Nodes, node)
 			continue
 		}
@@ -70,19 +127,166 @@ func (e *Expander) Parse() error {
 	return e.rdp.Error()
 }
 
+// Parses an expansion that is recognized both outside and inside double quotes:
+// a command substitution, an arithmetic expansion or a parameter expansion
+func (e *Expander) expansion() (ast.Node, bool) {
+	if node, ok := e.backtick(); ok {
+		return node, true
+	}
+
+	if node, ok := e.arithmetic(); ok {
+		return node, true
+	}
+
+	if node, ok := e.commandSubstitution(); ok {
+		return node, true
+	}
+
+	if node, ok := e.param(); ok {
+		return node, true
+	}
+
+	return nil, false
+}
+
+// Parses a string in single quotes. The characters inside the quotes are kept
+// literally (see 2.2.2 Single-Quotes).
+func (e *Expander) singleQuote() (*ast.SingleQuote, bool) {
+	if !e.rdp.Accept(expanderTokenApostrophe) {
+		return nil, false
+	}
+
+	s := strings.Builder{}
+	for !e.rdp.Check(expanderTokenApostrophe, expanderTokenEOF) {
+		s.WriteRune(rune(e.rdp.Current()))
+		e.rdp.Consume()
+	}
+
+	if !e.rdp.Accept(expanderTokenApostrophe) {
+		e.rdp.SetError(newSyntaxError(errors.New("unterminated quoted string")))
+		return nil, false
+	}
+
+	return ast.NewSingleQuote(s.String()), true
+}
+
+// Parses a string in double quotes. Expansions are recognized inside the quotes,
+// and a backslash quotes only a dollar sign, a backtick, a double quote, a
+// backslash or a newline (see 2.2.3 Double-Quotes).
+func (e *Expander) doubleQuote() (*ast.DoubleQuote, bool) {
+	if !e.rdp.Accept(expanderTokenQuotation) {
+		return nil, false
+	}
+
+	node := ast.NewDoubleQuote(e.quotedNodes(expanderTokenQuotation, "$`\"\\\n")...)
+
+	if !e.rdp.Accept(expanderTokenQuotation) {
+		if e.rdp.Error() == nil {
+			e.rdp.SetError(newSyntaxError(errors.New("unterminated quoted string")))
+		}
+
+		return nil, false
+	}
+
+	return node, true
+}
+
+// Parses the text up to the end token, in which only expansions are recognized
+// and a backslash quotes only the escapable characters provided (like inside
+// double-quotes). The end token is not consumed.
+func (e *Expander) quotedNodes(end ExpanderToken, escapable string) []ast.Node {
+	nodes := []ast.Node{}
+	s := strings.Builder{}
+
+	flush := func() {
+		if s.Len() > 0 {
+			nodes = append(nodes, ast.NewString(s.String()))
+			s.Reset()
+		}
+	}
+
+	for e.rdp.Error() == nil && !e.rdp.Check(end, expanderTokenEOF) {
+		if n, ok := e.expansion(); ok {
+			flush()
+			nodes = append(nodes, n)
+			continue
+		}
+
+		if e.rdp.Error() != nil {
+			return nil
+		}
+
+		current := e.rdp.Current()
+		e.rdp.Consume()
+
+		if current == expanderTokenBackslash && strings.ContainsRune(escapable, rune(e.rdp.Current())) {
+			current = e.rdp.Current()
+			e.rdp.Consume()
+
+			// a backslash-newline joins the lines
+			if current == '\n' {
+				continue
+			}
+		}
+
+		s.WriteRune(rune(current))
+	}
+
+	flush()
+
+	return nodes
+}
+
+// Parses the body of a here-document (see 2.7.4 Here-Document). The body is
+// expanded like a double-quoted string, except that double-quotes are literal.
+func (e *Expander) ParseHereDoc() error {
+	nodes := e.quotedNodes(expanderTokenEOF, "$`\\\n")
+	if e.rdp.Error() != nil {
+		return e.rdp.Error()
+	}
+
+	e.Expr = ast.NewExpr(ast.NewDoubleQuote(nodes...))
+
+	return nil
+}
+
+// Parses a character quoted by a backslash (see 2.2.1 Escape Character). A
+// backslash at the end of the expression is a literal backslash.
+func (e *Expander) escaped() (ast.Node, bool) {
+	if !e.rdp.Accept(expanderTokenBackslash) {
+		return nil, false
+	}
+
+	if e.rdp.Check(expanderTokenEOF) {
+		return ast.NewString("\\"), true
+	}
+
+	current := e.rdp.Current()
+	e.rdp.Consume()
+
+	return ast.NewEscaped(string(current)), true
+}
+
 func (e *Expander) backtick() (*ast.Backtick, bool) {
 	if !e.rdp.Accept(expanderTokenBacktick) {
 		return nil, false
 	}
 
+	// inside backticks, a backslash retains its literal meaning, except when
+	// followed by a dollar sign, a backtick or another backslash
 	s := ""
 
-	for {
-		if r, ok := e.char(); ok {
-			s += string(r)
-		} else {
-			break
+	for e.rdp.Error() == nil && !e.rdp.Check(expanderTokenBacktick, expanderTokenEOF) {
+		current := e.rdp.Current()
+		e.rdp.Consume()
+
+		if current == expanderTokenBackslash &&
+			e.rdp.Check(expanderTokenDollar, expanderTokenBacktick, expanderTokenBackslash) {
+			current = e.rdp.Current()
+			e.rdp.Consume()
 		}
+
+		s += string(current)
 	}
 
 	if !e.rdp.Expect(expanderTokenBacktick) {
@@ -91,72 +295,464 @@ func (e *Expander) backtick() (*ast.Backtick, bool) {
 
 	e.rdp.Consume()
 
-	// e2 := NewExpander(s)
-	// if err := e2.Parse(); err != nil {
-	// 	e.rdp.SetError(err)
-	// 	return nil, false
-	// }
+	program, ok := e.subprogram(s)
+	if !ok {
+		return nil, false
+	}
+
+	node := ast.NewBacktick()
+	node.Node = program
+
+	return node, true
+}
+
+// Parses a command substitution in the form `$(program)`. Unlike backticks, the
+// program is read as is, up to the matching parenthesis.
+func (e *Expander) commandSubstitution() (*ast.CommandSubstitution, bool) {
+	if !e.checkCommandSubstitutionStart() {
+		return nil, false
+	}
+
+	e.rdp.Consume()
+
+	b := strings.Builder{}
+	if !e.parenthesized(&b, true) {
+		e.rdp.SetError(newSyntaxError(errors.New("unterminated command substitution")))
+		return nil, false
+	}
+
+	// the program is the text inside the parentheses
+	s := b.String()
+	program, ok := e.subprogram(s[1 : len(s)-1])
+	if !ok {
+		return nil, false
+	}
+
+	node := ast.NewCommandSubstitution()
+	node.Node = program
+
+	return node, true
+}
+
+// Parses an arithmetic expansion in the form `$((expression))`. A `$((` that is
+// not closed by `))` (like `$((a) (b))`) is a command substitution of a subshell.
+func (e *Expander) arithmetic() (*ast.Arithmetic, bool) {
+	if !e.checkCommandSubstitutionStart() || e.peekN(2) != expanderTokenLParen {
+		return nil, false
+	}
+
+	b := e.rdp.Backup()
+	e.rdp.Consume()
+	e.rdp.Consume()
+
+	text := strings.Builder{}
+	if !e.parenthesized(&text, false) || !e.rdp.Accept(expanderTokenRParen) {
+		e.rdp.Restore(b)
+		return nil, false
+	}
+
+	// `~` is the bitwise not operator of arithmetic expressions
+	s := text.String()
+	expression := NewExpander(s[1 : len(s)-1])
+	expression.tilde = tildeNone
+	if err := expression.Parse(); err != nil {
+		e.rdp.SetError(err)
+		return nil, false
+	}
 
+	return ast.NewArithmetic(expression.Expr), true
+}
+
+// Reads the text from the current opening parenthesis up to the matching closing
+// parenthesis (inclusive) into the builder. Quoted parentheses are ignored, and
+// if the text is a program, so are the parentheses that end case patterns and
+// the parentheses in comments and here-documents.
+// Returns false if there is no matching parenthesis.
+func (e *Expander) parenthesized(b *strings.Builder, program bool) bool {
+	depth := 0
+	tracker := newProgramTracker()
+
+	for e.rdp.Error() == nil && !e.rdp.Check(expanderTokenEOF) {
+		current := e.rdp.Current()
+
+		// the comments and the bodies of here-documents are read as is
+		if program && tracker.skipping() {
+			tracker.add(rune(current), false, depth)
+			b.WriteRune(rune(current))
+			e.rdp.Consume()
+			continue
+		}
+
+		switch current {
+		case expanderTokenLParen:
+			tracker.add(rune(current), false, depth)
+			depth++
+		case expanderTokenRParen:
+			tracker.add(rune(current), false, depth)
+			if program && tracker.closesPattern(depth) {
+				break
+			}
+
+			depth--
+		case expanderTokenBackslash:
+			b.WriteRune(rune(current))
+			e.rdp.Consume()
+
+			if e.rdp.Check(expanderTokenEOF) {
+				return false
+			}
+
+			tracker.add(rune(e.rdp.Current()), true, depth)
+		case expanderTokenApostrophe, expanderTokenQuotation, expanderTokenBacktick:
+			start := b.Len()
+			e.quoted(b, current)
+
+			for _, r := range b.String()[start:] {
+				tracker.add(r, true, depth)
+			}
+
+			continue
+		default:
+			tracker.add(rune(current), false, depth)
+		}
+
+		b.WriteRune(rune(e.rdp.Current()))
+		e.rdp.Consume()
+
+		if depth == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parses the program of a command substitution. Syntax errors in the program
+// are errors of the entire expression.
+func (e *Expander) subprogram(s string) (*ast.Program, bool) {
 	tokenizer := NewTokenizerShort(s)
 	tokens, err := tokenizer.ReadAll()
 	if err != nil {
+		if !IsSyntaxError(err) {
+			err = newSyntaxError(err)
+		}
+
+		e.rdp.SetError(err)
 		return nil, false
 	}
+
 	parser := NewParserDefault(tokens)
 	if parser.Parse() != nil {
+		e.rdp.SetError(parser.Error())
 		return nil, false
 	}
 
-	node := ast.NewBacktick()
-	node.Node = parser.Program()
+	return parser.Program(), true
+}
+
+// Parses a parameter expansion (see 2.6.2 Parameter Expansion) in one of the
+// forms:
+//
+//	$name
+//	${expression}
+func (e *Expander) param() (*ast.Param, bool) {
+	if !e.checkParamStart() {
+		return nil, false
+	}
+
+	e.rdp.Consume()
+
+	if e.rdp.Accept(expanderTokenLBrace) {
+		return e.bracedParam()
+	}
+
+	// a positional parameter without braces is a single digit
+	current := rune(e.rdp.Current())
+	if isDigit(current) || strings.ContainsRune(specialParams, current) {
+		e.rdp.Consume()
+		return ast.NewParam(string(current)), true
+	}
+
+	name := ""
+	for isNameRune(rune(e.rdp.Current())) {
+		name += string(e.rdp.Current())
+		e.rdp.Consume()
+	}
+
+	return ast.NewParam(name), true
+}
+
+// Parses the expression of a parameter expansion in braces, after the opening
+// brace
+func (e *Expander) bracedParam() (*ast.Param, bool) {
+	// ${#name} is the length of the parameter while ${#} is a special parameter
+	length := false
+	if e.rdp.Check(expanderTokenNumberSign) && e.peek() != expanderTokenRBrace {
+		e.rdp.Consume()
+		length = true
+	}
+
+	name, ok := e.paramName()
+	if !ok {
+		return nil, e.badSubstitution()
+	}
+
+	node := ast.NewParam(name)
+
+	if length {
+		node.Op = ast.ParamOpLength
+	} else if op, ok := e.paramOp(); ok {
+		node.Op = op
+
+		word := NewExpander(e.paramWord())
+		if err := word.Parse(); err != nil {
+			e.rdp.SetError(err)
+			return nil, false
+		}
+
+		node.Word = word.Expr
+	}
+
+	if !e.rdp.Accept(expanderTokenRBrace) {
+		return nil, e.badSubstitution()
+	}
 
 	return node, true
 }
 
-func (e *Expander) string() (*ast.String, bool) {
-	s := ast.NewString("")
+// Parses the name of the parameter in braces: a special parameter, a positional
+// parameter (one or more digits) or a variable name
+func (e *Expander) paramName() (string, bool) {
+	current := rune(e.rdp.Current())
+	if strings.ContainsRune(specialParams, current) {
+		e.rdp.Consume()
+		return string(current), true
+	}
 
-	for {
-		if r, ok := e.char(); ok {
-			s.Value += string(r)
-		} else {
-			break
+	name := ""
+	if isDigit(current) {
+		for isDigit(rune(e.rdp.Current())) {
+			name += string(e.rdp.Current())
+			e.rdp.Consume()
 		}
+
+		return name, true
 	}
 
-	if s.Value == "" {
-		return nil, false
+	for isNameRune(rune(e.rdp.Current())) {
+		name += string(e.rdp.Current())
+		e.rdp.Consume()
 	}
 
-	return s, true
+	return name, isName(name)
+}
+
+// Parses the operator of a parameter expansion in braces, if there is one
+func (e *Expander) paramOp() (ast.ParamOp, bool) {
+	colon := e.rdp.Accept(expanderTokenColon)
+
+	current := rune(e.rdp.Current())
+	if strings.ContainsRune("-=?+", current) {
+		e.rdp.Consume()
+
+		if colon {
+			return ast.ParamOp(":" + string(current)), true
+		}
+
+		return ast.ParamOp(current), true
+	}
+
+	if colon {
+		e.badSubstitution()
+		return "", false
+	}
+
+	for _, t := range []ExpanderToken{expanderTokenPercent, expanderTokenNumberSign} {
+		if e.rdp.Accept(t) {
+			if e.rdp.Accept(t) {
+				return ast.ParamOp(string(t) + string(t)), true
+			}
+
+			return ast.ParamOp(t), true
+		}
+	}
+
+	return "", false
+}
+
+// Reads the raw word of a parameter expansion in braces, up to the closing brace.
+// Quotes, backslashes and nested expansions are kept in the word, so braces
+// inside them do not close the expansion.
+func (e *Expander) paramWord() string {
+	b := strings.Builder{}
+	depth := 0
+
+	for !e.rdp.Check(expanderTokenEOF) {
+		current := e.rdp.Current()
+
+		switch {
+		case current == expanderTokenRBrace && depth == 0:
+			return b.String()
+		case current == expanderTokenRBrace:
+			depth--
+		case current == expanderTokenDollar && e.peek() == expanderTokenLBrace:
+			b.WriteRune(rune(current))
+			e.rdp.Consume()
+			depth++
+		case current == expanderTokenDollar && e.peek() == expanderTokenLParen:
+			b.WriteRune(rune(current))
+			e.rdp.Consume()
+
+			if !e.parenthesized(&b, true) {
+				return b.String()
+			}
+
+			continue
+		case current == expanderTokenBackslash:
+			b.WriteRune(rune(current))
+			e.rdp.Consume()
+
+			if e.rdp.Check(expanderTokenEOF) {
+				return b.String()
+			}
+		case current == expanderTokenApostrophe ||
+			current == expanderTokenQuotation ||
+			current == expanderTokenBacktick:
+			e.quoted(&b, current)
+			continue
+		}
+
+		b.WriteRune(rune(e.rdp.Current()))
+		e.rdp.Consume()
+	}
+
+	return b.String()
 }
 
-func (e *Expander) char() (rune, bool) {
-	if r, ok := e.backslash(); ok {
-		return r, true
-	} else if e.checkNotSpecial() {
-		currentRune := rune(e.rdp.Current())
+// Reads a quoted part of a word, from the current quote up to the matching quote,
+// into the builder. Inside double quotes and backticks, a backslash escapes the
+// next character.
+func (e *Expander) quoted(b *strings.Builder, quote ExpanderToken) {
+	b.WriteRune(rune(quote))
+	e.rdp.Consume()
+
+	for !e.rdp.Check(expanderTokenEOF) {
+		current := e.rdp.Current()
+		b.WriteRune(rune(current))
 		e.rdp.Consume()
-		return currentRune, true
+
+		if current == quote {
+			return
+		}
+
+		if current == expanderTokenBackslash && quote != expanderTokenApostrophe &&
+			!e.rdp.Check(expanderTokenEOF) {
+			b.WriteRune(rune(e.rdp.Current()))
+			e.rdp.Consume()
+		}
+	}
+}
+
+// Returns whether the current token starts a parameter expansion. A dollar sign
+// that is not followed by a parameter is a literal dollar sign.
+func (e *Expander) checkParamStart() bool {
+	if !e.rdp.Check(expanderTokenDollar) {
+		return false
 	}
 
-	return utf8.RuneError, false
+	next := rune(e.peek())
+	return next == '{' || isNameRune(next) || strings.ContainsRune(specialParams, next)
 }
 
-func (e *Expander) backslash() (rune, bool) {
-	if e.rdp.Accept(expanderTokenBackslash) {
-		if e.rdp.Check(expanderTokenEOF) {
-			return utf8.RuneError, false
+// Parses a tilde-prefix: an unquoted tilde followed by the characters up to the
+// first slash (or colon, in assignments). If any of the characters is quoted or
+// special, the tilde is a literal string.
+func (e *Expander) tildePrefix() (ast.Node, bool) {
+	if !e.checkTildeStart() {
+		return nil, false
+	}
+
+	e.rdp.Consume()
+	b := e.rdp.Backup()
+
+	user := ""
+	for !e.rdp.Check(expanderTokenSlash, expanderTokenEOF) &&
+		!(e.tilde == tildeAssignment && e.rdp.Check(expanderTokenColon)) {
+		current := rune(e.rdp.Current())
+		if !isNameRune(current) && current != '.' && current != '-' {
+			e.rdp.Restore(b)
+			return ast.NewString("~"), true
 		}
 
-		currentRune := rune(e.rdp.Current())
+		user += string(current)
+		e.rdp.Consume()
+	}
+
+	return ast.NewTilde(user), true
+}
+
+// Returns whether the current token starts a tilde-prefix
+func (e *Expander) checkTildeStart() bool {
+	if !e.rdp.Check(expanderTokenTilde) {
+		return false
+	}
+
+	switch e.tilde {
+	case tildeWord:
+		return e.rdp.Index == 0
+	case tildeAssignment:
+		return e.rdp.Index == 0 || e.rdp.Prev() == expanderTokenColon
+	}
+
+	return false
+}
+
+// Returns whether the current token starts a command substitution
+func (e *Expander) checkCommandSubstitutionStart() bool {
+	return e.rdp.Check(expanderTokenDollar) && e.peek() == expanderTokenLParen
+}
+
+// Returns the token after the current token
+func (e *Expander) peek() ExpanderToken {
+	return e.peekN(1)
+}
+
+// Returns the n-th token after the current token
+func (e *Expander) peekN(n int) ExpanderToken {
+	if e.rdp.Index+n >= len(e.rdp.Tokens) {
+		return expanderTokenEOF
+	}
+
+	return e.rdp.Tokens[e.rdp.Index+n]
+}
+
+// Sets a bad substitution syntax error and returns false
+func (e *Expander) badSubstitution() bool {
+	if e.rdp.Error() == nil {
+		e.rdp.SetError(newSyntaxError(errors.New("bad substitution")))
+	}
+
+	return false
+}
+
+// Parses an unquoted string, up to the next quote or expansion
+func (e *Expander) string() (*ast.String, bool) {
+	s := ast.NewString("")
+
+	for e.rdp.Error() == nil && e.checkNotSpecial() {
+		s.Value += string(e.rdp.Current())
 		e.rdp.Consume()
-		return currentRune, true
 	}
 
-	return utf8.RuneError, false
+	if s.Value == "" {
+		return nil, false
+	}
+
+	return s, true
 }
 
 func (e *Expander) checkNotSpecial() bool {
-	return !e.rdp.Check(expanderTokenBacktick, expanderTokenEOF)
+	return !e.rdp.Check(expanderTokenBacktick, expanderTokenBackslash, expanderTokenApostrophe,
+		expanderTokenQuotation, expanderTokenEOF) &&
+		!e.checkParamStart() && !e.checkCommandSubstitutionStart() && !e.checkTildeStart()
 }
@@ -16,6 +16,173 @@ func TestExpanderBacktickRecursive(t *testing.T) {
 	))
 }
 
+func TestExpanderCommandSubstitution(t *testing.T) {
+	testCommandSubstitution := func(expr string, expected ...ast.Node) {
+		e := NewExpander(expr)
+		require.NoError(t, e.Parse(), expr)
+		require.Equal(t, ast.NewExpr(expected...), e.Expr, expr)
+	}
+
+	program := func(expr string) ast.Node {
+		p := parseDefaultText(t, expr)
+		require.NoError(t, p.Error())
+		return p.Program()
+	}
+
+	testCommandSubstitution("$(a b)", &ast.CommandSubstitution{Node: program("a b")})
+	testCommandSubstitution("x$(a)y", ast.NewString("x"), &ast.CommandSubstitution{Node: program("a")}, ast.NewString("y"))
+	testCommandSubstitution("$(a $(b))", &ast.CommandSubstitution{Node: program("a $(b)")})
+	testCommandSubstitution("$( (a) )", &ast.CommandSubstitution{Node: program("(a)")})
+	testCommandSubstitution("$(a ')')", &ast.CommandSubstitution{Node: program("a ')'")})
+	testCommandSubstitution("$(case a in a) b;; esac)", &ast.CommandSubstitution{Node: program("case a in a) b;; esac")})
+	testCommandSubstitution("$(echo case)x", &ast.CommandSubstitution{Node: program("echo case")}, ast.NewString("x"))
+	testCommandSubstitution("$(a # )\n)", &ast.CommandSubstitution{Node: program("a # )\n")})
+	testCommandSubstitution("$(a <<X\n)\nX\n)", &ast.CommandSubstitution{Node: program("a <<X\n)\nX\n")})
+	testCommandSubstitution("$x$(a)", &ast.Param{Name: "x"}, &ast.CommandSubstitution{Node: program("a")})
+	testCommandSubstitution("${x:-$(a })}", &ast.Param{
+		Name: "x",
+		Op:   ast.ParamOpDefaultNull,
+		Word: ast.NewExpr(&ast.CommandSubstitution{Node: program("a }")}),
+	})
+
+	// syntax errors inside command substitutions are not ignored
+	for _, expr := range []string{"$(a", "$(a;;)", "$(if)", "`a;;`", "`'a`"} {
+		e := NewExpander(expr)
+		require.True(t, IsSyntaxError(e.Parse()), expr)
+	}
+}
+
+func TestExpanderArithmetic(t *testing.T) {
+	testArithmetic := func(expr string, expected ...ast.Node) {
+		e := NewExpander(expr)
+		require.NoError(t, e.Parse(), expr)
+		require.Equal(t, ast.NewExpr(expected...), e.Expr, expr)
+	}
+
+	testArithmetic("$((1 + 2))", ast.NewArithmetic(ast.NewExprStr("1 + 2")))
+	testArithmetic("a$(((1) * (2)))b",
+		ast.NewString("a"),
+		ast.NewArithmetic(ast.NewExprStr("(1) * (2)")),
+		ast.NewString("b"),
+	)
+	testArithmetic("$(($x + $(a)))", ast.NewArithmetic(ast.NewExpr(
+		&ast.Param{Name: "x"},
+		ast.NewString(" + "),
+		&ast.CommandSubstitution{Node: parseDefaultText(t, "a").Program()},
+	)))
+
+	// not closed by `))`, this is a command substitution of a subshell
+	testArithmetic("$((a) && (b))", &ast.CommandSubstitution{Node: parseDefaultText(t, "(a) && (b)").Program()})
+
+	e := NewExpander("$((1 + 2)")
+	require.True(t, IsSyntaxError(e.Parse()))
+}
+
+func TestExpanderTilde(t *testing.T) {
+	testTilde := func(e *Expander, expected ...ast.Node) {
+		require.NoError(t, e.Parse())
+		require.Equal(t, ast.NewExpr(expected...), e.Expr)
+	}
+
+	testTilde(NewExpander("~"), ast.NewTilde(""))
+	testTilde(NewExpander("~/a"), ast.NewTilde(""), ast.NewString("/a"))
+	testTilde(NewExpander("~user.name-1/a"), ast.NewTilde("user.name-1"), ast.NewString("/a"))
+	testTilde(NewExpander("a~"), ast.NewString("a~"))
+	testTilde(NewExpander("~$x"), ast.NewString("~"), &ast.Param{Name: "x"})
+	testTilde(NewExpander("~a:~b"), ast.NewString("~"), ast.NewString("a:~b"))
+	testTilde(NewAssignmentExpander("~a:~b/c:d~"),
+		ast.NewTilde("a"),
+		ast.NewString(":"),
+		ast.NewTilde("b"),
+		ast.NewString("/c:d~"),
+	)
+}
+
+func TestExpanderQuotes(t *testing.T) {
+	testQuotes := func(expr string, expected ...ast.Node) {
+		e := NewExpander(expr)
+		require.NoError(t, e.Parse(), expr)
+		require.Equal(t, ast.NewExpr(expected...), e.Expr, expr)
+	}
+
+	testQuotes("'a $b `c` \\'", ast.NewSingleQuote("a $b `c` \\"))
+	testQuotes("a'b'c", ast.NewString("a"), ast.NewSingleQuote("b"), ast.NewString("c"))
+	testQuotes("''", ast.NewSingleQuote(""))
+	testQuotes("\"\"", ast.NewDoubleQuote())
+	testQuotes("\"a  b\"", ast.NewDoubleQuote(ast.NewString("a  b")))
+	testQuotes("\"a'$b'\"", ast.NewDoubleQuote(ast.NewString("a'"), &ast.Param{Name: "b"}, ast.NewString("'")))
+	testQuotes("\"\\$a\\\"\\\\\\b\\`\"", ast.NewDoubleQuote(ast.NewString("$a\"\\\\b`")))
+	testQuotes("\"$(a \"b\")${x:-\"y\"}\"", ast.NewDoubleQuote(
+		&ast.CommandSubstitution{Node: parseDefaultText(t, "a \"b\"").Program()},
+		&ast.Param{Name: "x", Op: ast.ParamOpDefaultNull, Word: ast.NewExpr(ast.NewDoubleQuote(ast.NewString("y")))},
+	))
+	testQuotes("\\a\\ \\'", ast.NewEscaped("a"), ast.NewEscaped(" "), ast.NewEscaped("'"))
+	testQuotes("a\"$@\"b", ast.NewString("a"), ast.NewDoubleQuote(&ast.Param{Name: "@"}), ast.NewString("b"))
+
+	for _, expr := range []string{"'a", "\"a", "a\"$x", "\"${x\""} {
+		e := NewExpander(expr)
+		require.True(t, IsSyntaxError(e.Parse()), expr)
+	}
+}
+
+func TestExpanderParam(t *testing.T) {
+	testExpanderParam(t, "$x", &ast.Param{Name: "x"})
+	testExpanderParam(t, "$x_1", &ast.Param{Name: "x_1"})
+	testExpanderParam(t, "${x}", &ast.Param{Name: "x"})
+	testExpanderParam(t, "$1", &ast.Param{Name: "1"})
+	testExpanderParam(t, "${10}", &ast.Param{Name: "10"})
+	testExpanderParam(t, "$@", &ast.Param{Name: "@"})
+	testExpanderParam(t, "${#}", &ast.Param{Name: "#"})
+	testExpanderParam(t, "${#x}", &ast.Param{Name: "x", Op: ast.ParamOpLength})
+	testExpanderParam(t, "${##}", &ast.Param{Name: "#", Op: ast.ParamOpLength})
+	testExpanderParam(t, "${x-w}", &ast.Param{Name: "x", Op: ast.ParamOpDefault, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x:-w}", &ast.Param{Name: "x", Op: ast.ParamOpDefaultNull, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x=w}", &ast.Param{Name: "x", Op: ast.ParamOpAssign, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x:=w}", &ast.Param{Name: "x", Op: ast.ParamOpAssignNull, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x?w}", &ast.Param{Name: "x", Op: ast.ParamOpError, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x:?}", &ast.Param{Name: "x", Op: ast.ParamOpErrorNull, Word: ast.NewExpr()})
+	testExpanderParam(t, "${x+w}", &ast.Param{Name: "x", Op: ast.ParamOpAlternative, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x:+w}", &ast.Param{Name: "x", Op: ast.ParamOpAlternativeNull, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x%w}", &ast.Param{Name: "x", Op: ast.ParamOpRemoveSmallestSuffix, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x%%w}", &ast.Param{Name: "x", Op: ast.ParamOpRemoveLargestSuffix, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x#w}", &ast.Param{Name: "x", Op: ast.ParamOpRemoveSmallestPrefix, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x##w}", &ast.Param{Name: "x", Op: ast.ParamOpRemoveLargestPrefix, Word: ast.NewExprStr("w")})
+	testExpanderParam(t, "${x:-$y}", &ast.Param{Name: "x", Op: ast.ParamOpDefaultNull, Word: ast.NewExpr(&ast.Param{Name: "y"})})
+	testExpanderParam(t, "${x:-a${y:-}}", &ast.Param{
+		Name: "x",
+		Op:   ast.ParamOpDefaultNull,
+		Word: ast.NewExpr(
+			ast.NewString("a"),
+			&ast.Param{Name: "y", Op: ast.ParamOpDefaultNull, Word: ast.NewExpr()},
+		),
+	})
+
+	e := NewExpander("a$x-${y}$")
+	require.NoError(t, e.Parse())
+	require.Equal(t, ast.NewExpr(
+		ast.NewString("a"),
+		&ast.Param{Name: "x"},
+		ast.NewString("-"),
+		&ast.Param{Name: "y"},
+		ast.NewString("$"),
+	), e.Expr)
+
+	e = NewExpander("\\$x$ y$$")
+	require.NoError(t, e.Parse())
+	require.Equal(t, ast.NewExpr(ast.NewEscaped("$"), ast.NewString("x$ y"), &ast.Param{Name: "$"}), e.Expr)
+
+	for _, expr := range []string{"${}", "${x", "${x:}", "${x;}", "${1x}", "${x:-"} {
+		e := NewExpander(expr)
+		require.True(t, IsSyntaxError(e.Parse()), expr)
+	}
+}
+
+func testExpanderParam(t *testing.T, expr string, param *ast.Param) {
+	e := NewExpander(expr)
+	require.NoError(t, e.Parse())
+	require.Equal(t, ast.NewExpr(param), e.Expr, expr)
+}
+
 func testExpander(t *testing.T, expr string, node ast.Node) {
 	e := NewExpander(expr)
 	require.NoError(t, e.Parse())
@@ -0,0 +1,174 @@
+package gobash
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Expands the field into the pathnames matching its pattern (see 2.6.6 Pathname
+// Expansion). If the pattern has no unquoted special characters, pathname
+// expansion is disabled (set -f) or no pathname matches the pattern, the field
+// is kept as is.
+func (e *Executor) expandPathname(f field, env *ExecEnv) []string {
+	if env.Options.NoGlob || !hasPatternChars(f.Pattern) {
+		return []string{f.Value}
+	}
+
+	matches := e.glob(f.Pattern, env)
+	if len(matches) == 0 {
+		return []string{f.Value}
+	}
+
+	return matches
+}
+
+// Returns the pathnames that match the pattern, sorted. Relative patterns are
+// matched from the working directory and return relative pathnames. A slash is
+// matched only by a slash in the pattern, and a leading period of a filename
+// only by a period at the start of the pattern component (see 2.13.3 Patterns
+// Used for Filename Expansion).
+func (e *Executor) glob(pattern string, env *ExecEnv) []string {
+	fsys := e.fileSystem()
+
+	prefixes := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		prefixes = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+
+	components := strings.Split(pattern, "/")
+	for i, component := range components {
+		last := i == len(components)-1
+		next := []string{}
+
+		// a trailing slash matches only directories
+		if component == "" {
+			if last {
+				for _, prefix := range prefixes {
+					if info, err := fs.Stat(fsys, e.globPath(prefix, env)); err == nil && info.IsDir() {
+						next = append(next, prefix)
+					}
+				}
+			} else {
+				next = prefixes
+			}
+
+			prefixes = next
+			continue
+		}
+
+		separator := "/"
+		if last {
+			separator = ""
+		}
+
+		if !hasPatternChars(component) {
+			literal := unescapePattern(component)
+			for _, prefix := range prefixes {
+				if _, err := fs.Stat(fsys, e.globPath(prefix+literal, env)); err == nil {
+					next = append(next, prefix+literal+separator)
+				}
+			}
+
+			prefixes = next
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			entries, err := fs.ReadDir(fsys, e.globPath(prefix, env))
+			if err != nil {
+				continue
+			}
+
+			for _, entry := range entries {
+				name := entry.Name()
+				if strings.HasPrefix(name, ".") && !strings.HasPrefix(unescapePattern(component), ".") {
+					continue
+				}
+
+				if !last && !entry.IsDir() && entry.Type()&fs.ModeSymlink == 0 {
+					continue
+				}
+
+				if matchPattern(component, name) {
+					next = append(next, prefix+name+separator)
+				}
+			}
+		}
+
+		prefixes = next
+	}
+
+	sort.Strings(prefixes)
+
+	return prefixes
+}
+
+// Returns the path in the file system of the pathname. Relative pathnames are
+// resolved from the working directory.
+func (e *Executor) globPath(pathname string, env *ExecEnv) string {
+	if !strings.HasPrefix(pathname, "/") {
+		pathname = path.Join(env.WorkingDirectory, pathname)
+	}
+
+	p := strings.TrimPrefix(path.Clean("/"+pathname), "/")
+	if p == "" {
+		return "."
+	}
+
+	return p
+}
+
+// Returns whether the pattern has unescaped special characters (*, ? or [)
+func hasPatternChars(pattern string) bool {
+	escaped := false
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '?' || r == '[':
+			return true
+		}
+	}
+
+	return false
+}
+
+// Escapes the special characters of the string, so it is matched literally when
+// used as a pattern
+func escapePattern(str string) string {
+	b := strings.Builder{}
+
+	for _, r := range str {
+		if strings.ContainsRune("*?[]\\", r) {
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Removes the escaping backslashes of the pattern
+func unescapePattern(pattern string) string {
+	b := strings.Builder{}
+	escaped := false
+
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+
+		escaped = false
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,326 @@
+package gobash
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/omerhorev/gobash/ast"
+)
+
+// Signals that can be sent to jobs using the kill built-in or Job.Kill. Jobs are
+// not backed by real processes, so every signal that is delivered to a job
+// cancels it.
+const (
+	SignalHUP  = 1
+	SignalINT  = 2
+	SignalQUIT = 3
+	SignalABRT = 6
+	SignalKILL = 9
+	SignalALRM = 14
+	SignalTERM = 15
+)
+
+// The names of the supported signals (without the SIG prefix) and the job
+// state reported by the jobs built-in when a job is killed by them
+var signals = []struct {
+	Number      int
+	Name        string
+	Description string
+}{
+	{SignalHUP, "HUP", "Hangup"},
+	{SignalINT, "INT", "Interrupt"},
+	{SignalQUIT, "QUIT", "Quit"},
+	{SignalABRT, "ABRT", "Aborted"},
+	{SignalKILL, "KILL", "Killed"},
+	{SignalALRM, "ALRM", "Alarm clock"},
+	{SignalTERM, "TERM", "Terminated"},
+}
+
+// Returns the signal number from a signal name (like TERM or SIGTERM) or a
+// signal number. The number 0 is valid and used to only check that a job exists.
+func parseSignal(str string) (int, bool) {
+	if n, err := strconv.Atoi(str); err == nil {
+		if n == 0 {
+			return 0, true
+		}
+
+		_, ok := signalName(n)
+		return n, ok
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(str), "SIG")
+	for _, s := range signals {
+		if s.Name == name {
+			return s.Number, true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the name of the signal number provided
+func signalName(n int) (string, bool) {
+	for _, s := range signals {
+		if s.Number == n {
+			return s.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// A Job is an asynchronous list (`a &`) that is executed in the background by
+// the Executor. Jobs are not backed by real processes, so their process IDs are
+// only meaningful to the shell (`$!`, `wait`, `kill`, etc).
+type Job struct {
+	Id   int      // The job number (%1, %2, etc)
+	Pid  int      // The process ID of the job as reported by $!
+	Node ast.Node // The executed AST
+	Text string   // The command text of the job
+
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the job finishes
+
+	mu     sync.Mutex
+	status int // the exit status of the job, valid after done is closed
+	signal int // the signal that killed the job, or 0
+}
+
+// Blocks until the job finishes and returns its exit status
+func (j *Job) Wait() int {
+	<-j.done
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+// Returns whether the job has finished
+func (j *Job) Done() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sends the signal to the job. The execution of the job is canceled and once
+// it finishes, its exit status is 128 plus the signal number.
+func (j *Job) Kill(signal int) {
+	if j.Done() {
+		return
+	}
+
+	j.mu.Lock()
+	if j.signal == 0 {
+		j.signal = signal
+	}
+	j.mu.Unlock()
+
+	j.cancel()
+}
+
+// Sets the exit status of the job and marks it as done
+func (j *Job) finish(status int) {
+	j.mu.Lock()
+	if j.signal != 0 {
+		status = 128 + j.signal
+	}
+	j.status = status
+	j.mu.Unlock()
+
+	j.cancel()
+	close(j.done)
+}
+
+// Returns the state of the job as reported by the jobs built-in
+func (j *Job) state() string {
+	if !j.Done() {
+		return "Running"
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.signal != 0 {
+		for _, s := range signals {
+			if s.Number == j.signal {
+				return s.Description
+			}
+		}
+	}
+
+	if j.status != 0 {
+		return fmt.Sprintf("Done(%d)", j.status)
+	}
+
+	return "Done"
+}
+
+// The table of the background jobs known to the Executor. It is safe for
+// concurrent use.
+type jobTable struct {
+	mu      sync.Mutex
+	jobs    []*Job
+	lastPid int
+}
+
+func newJobTable() *jobTable {
+	return &jobTable{
+		jobs: []*Job{},
+	}
+}
+
+// Adds a new job to the table and returns it. The job is executed with a context
+// derived from the context provided.
+func (t *jobTable) add(ctx context.Context, node ast.Node, text string) (*Job, context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// job numbers are reused once the jobs are removed from the table
+	id := 1
+	if len(t.jobs) > 0 {
+		id = t.jobs[len(t.jobs)-1].Id + 1
+	}
+
+	t.lastPid++
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	j := &Job{
+		Id:     id,
+		Pid:    t.lastPid,
+		Node:   node,
+		Text:   text,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	t.jobs = append(t.jobs, j)
+
+	return j, ctx
+}
+
+// Returns the job with the process ID provided, or nil if there is no such job
+func (t *jobTable) get(pid int) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, j := range t.jobs {
+		if j.Pid == pid {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// Returns the job identified by a job ID (see 3.204 Job Control Job ID) or by
+// a process ID:
+//
+//   - %%, %+ and % are the current job (the last job started)
+//   - %- is the previous job
+//   - %n is the job number n
+//   - %string is the job whose command begins with string
+//   - %?string is the job whose command contains string
+func (t *jobTable) find(spec string) (*Job, error) {
+	if !strings.HasPrefix(spec, "%") {
+		pid, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: not a pid or valid job spec", spec)
+		}
+
+		if j := t.get(pid); j != nil {
+			return j, nil
+		}
+
+		return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+	}
+
+	jobs := t.all()
+	id := spec[1:]
+
+	var found *Job
+	switch {
+	case id == "" || id == "%" || id == "+":
+		if len(jobs) > 0 {
+			found = jobs[len(jobs)-1]
+		}
+	case id == "-":
+		if len(jobs) > 1 {
+			found = jobs[len(jobs)-2]
+		}
+	case isDigit([]rune(id)[0]):
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+
+		for _, j := range jobs {
+			if j.Id == n {
+				found = j
+			}
+		}
+	default:
+		for _, j := range jobs {
+			var match bool
+			if strings.HasPrefix(id, "?") {
+				match = strings.Contains(j.Text, id[1:])
+			} else {
+				match = strings.HasPrefix(j.Text, id)
+			}
+
+			if !match {
+				continue
+			}
+
+			if found != nil {
+				return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+			}
+
+			found = j
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	return found, nil
+}
+
+// Returns all the jobs in the table, ordered by their start time
+func (t *jobTable) all() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*Job{}, t.jobs...)
+}
+
+// Removes the job from the table. The shell forgets about a job once its exit
+// status is reported (by wait, fg or jobs).
+func (t *jobTable) remove(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, v := range t.jobs {
+		if v == j {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the process ID of the last job added to the table (`$!`), or 0 if no
+// jobs were executed yet
+func (t *jobTable) lastBackgroundPid() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lastPid
+}
@@ -16,7 +16,7 @@ type MockFile struct {
 
 // Creates a new mock file. The flag and perm mocks the behavior of os.OpenFile
 func NewMockFile(flag int, perm os.FileMode, buffer *bytes.Buffer) *MockFile {
-	rwMode := flag & 0x2
+	rwMode := flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
 
 	f := MockFile{
 		AllowRead:  rwMode == os.O_RDONLY || rwMode == os.O_RDWR,
@@ -25,7 +25,7 @@ func NewMockFile(flag int, perm os.FileMode, buffer *bytes.Buffer) *MockFile {
 		b:          buffer,
 	}
 
-	if flag&os.O_APPEND == 0 && f.AllowWrite {
+	if flag&os.O_TRUNC != 0 && f.AllowWrite {
 		f.b.Reset()
 	}
 
@@ -58,6 +58,11 @@ func (f *MockFile) Close() error {
 	return nil
 }
 
+// Testing operation. Returns whether the mock file was closed
+func (f *MockFile) Closed() bool {
+	return !f.opened
+}
+
 // Testing operation. Returns the amount of data in the buffer
 func (f *MockFile) Len() int {
 	return f.b.Len()
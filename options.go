@@ -0,0 +1,97 @@
+package gobash
+
+import "fmt"
+
+// The options of the shell. Each option has a single letter flag that is reported
+// by the $- special parameter, and most of them can be changed by the set
+// special built-in with their flag or name (like `set -e` or `set -o errexit`).
+type Options struct {
+	// The shell is interactive (i)
+	Interactive bool
+
+	// Exit the shell when a command fails, unless it is a condition (errexit, e)
+	ErrExit bool
+
+	// Disable pathname expansion (noglob, f)
+	NoGlob bool
+
+	// Do not overwrite existing regular files with the > redirection, the >|
+	// redirection overwrites them regardless (noclobber, C)
+	NoClobber bool
+
+	// Read commands but do not execute them, ignored by interactive shells
+	// (noexec, n)
+	NoExec bool
+
+	// Expanding an unset parameter is an error (nounset, u)
+	NoUnset bool
+
+	// Write the input of the shell to stderr as it is read. Scripts are read as a
+	// whole before they are executed, so it affects only the input that is read
+	// after the option is set (verbose, v)
+	Verbose bool
+
+	// Write a trace of each command to stderr before it is executed (xtrace, x)
+	XTrace bool
+
+	// The exit status of a pipeline is the one of the last command that failed,
+	// or zero if all of them succeeded (pipefail)
+	PipeFail bool
+}
+
+// An option of the shell, as changed by the set special built-in
+type option struct {
+	Name  string // the name used with -o, empty if it cannot be changed
+	Flag  rune   // the single letter flag, zero if it has none
+	Value func(o *Options) *bool
+}
+
+// The options ordered by their flags, as reported by $-
+var options = []option{
+	{Name: "noclobber", Flag: 'C', Value: func(o *Options) *bool { return &o.NoClobber }},
+	{Name: "errexit", Flag: 'e', Value: func(o *Options) *bool { return &o.ErrExit }},
+	{Name: "noglob", Flag: 'f', Value: func(o *Options) *bool { return &o.NoGlob }},
+	{Name: "", Flag: 'i', Value: func(o *Options) *bool { return &o.Interactive }},
+	{Name: "noexec", Flag: 'n', Value: func(o *Options) *bool { return &o.NoExec }},
+	{Name: "nounset", Flag: 'u', Value: func(o *Options) *bool { return &o.NoUnset }},
+	{Name: "verbose", Flag: 'v', Value: func(o *Options) *bool { return &o.Verbose }},
+	{Name: "xtrace", Flag: 'x', Value: func(o *Options) *bool { return &o.XTrace }},
+	{Name: "pipefail", Flag: 0, Value: func(o *Options) *bool { return &o.PipeFail }},
+}
+
+// Returns the flags of the options that are enabled, as expanded by $-
+func (o Options) Flags() string {
+	flags := ""
+
+	for _, opt := range options {
+		if opt.Flag != 0 && *opt.Value(&o) {
+			flags += string(opt.Flag)
+		}
+	}
+
+	return flags
+}
+
+// Sets the option with the flag provided (like 'e')
+func (o *Options) SetFlag(flag rune, value bool) error {
+	for _, opt := range options {
+		if opt.Flag == flag && opt.Name != "" {
+			*opt.Value(o) = value
+			return nil
+		}
+	}
+
+	return fmt.Errorf("-%c: invalid option", flag)
+}
+
+// Sets the option with the name provided (like "errexit")
+func (o *Options) SetName(name string, value bool) error {
+	for _, opt := range options {
+		if opt.Name == name && opt.Name != "" {
+			*opt.Value(o) = value
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: invalid option name", name)
+}
@@ -1,6 +1,9 @@
 package gobash
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
@@ -9,7 +12,11 @@ import (
 )
 
 // Represents settings for the Parser
-type ParserSettings struct{}
+type ParserSettings struct {
+	// The aliases substituted for command words, by name (see 2.3.1 Alias
+	// Substitution). Nil disables alias substitution.
+	Aliases map[string]string
+}
 
 var parserDefaultSettings = ParserSettings{}
 
@@ -52,6 +59,17 @@ func (p *Parser) Error() error {
 	return p.rdp.Error()
 }
 
+// Returns whether the parsing failed because the tokens ended in the middle of
+// a command, so the input may continue on the following lines (like an if
+// command without fi)
+func (p *Parser) Incomplete() bool {
+	if p.rdp.Error() == nil {
+		return false
+	}
+
+	return p.rdp.Furthest >= len(p.rdp.Tokens)-1 || errors.Is(p.rdp.Error(), io.ErrUnexpectedEOF)
+}
+
 // Returns the generated AST as a program node to be used by the executor
 // This method can be used only after calling the Parse method
 func (p *Parser) Program() *ast.Program {
@@ -131,6 +149,12 @@ func (p *Parser) parse() error {
 
 	program, _ := p.program()
 
+	if p.rdp.Error() != nil {
+		p.rdp.Restore(b)
+
+		return p.rdp.Error()
+	}
+
 	if !p.rdp.Expect(tokenIdentifierEOF) {
 		p.rdp.Restore(b)
 
@@ -166,7 +190,10 @@ func (p *Parser) completeCommands() (nodes []ast.Node, ok bool) {
 		return nil, false
 	}
 
-	p.linebreak()
+	// complete commands are separated by newlines
+	if !p.newlineList() {
+		return nodes, true
+	}
 
 	nodes2, ok2 := p.completeCommands()
 	if ok2 {
@@ -186,16 +213,22 @@ func (p *Parser) completeCommand() ([]ast.Node, bool) {
 		return nil, false
 	}
 
+	separated := true
 	if p.rdp.Accept(tokenIdentifierSemicolon) {
 		// do nothing, just a semicolon
+	} else if p.rdp.Accept(tokenIdentifierAnd) {
+		node = p.background(node, b)
 	} else {
-		if p.rdp.Accept(tokenIdentifierAnd) {
-			node = ast.NewBackground(node)
-		}
+		separated = false
 	}
 
 	nodes := []ast.Node{node}
 
+	// commands on the same line must be separated by an operator
+	if !separated {
+		return nodes, true
+	}
+
 	if nodes2, ok := p.completeCommand(); ok {
 		nodes = append(nodes, nodes2...)
 	}
@@ -203,6 +236,62 @@ func (p *Parser) completeCommand() ([]ast.Node, bool) {
 	return nodes, true
 }
 
+// derived from the compound_list grammar rule:
+//
+//	compound_list : linebreak term
+//	              | linebreak term separator
+//
+// the term rule is flattened into a list of and_or nodes.
+func (p *Parser) compoundList() ([]ast.Node, bool) {
+	p.linebreak()
+
+	nodes := []ast.Node{}
+
+	for {
+		b := p.rdp.Backup()
+
+		node, ok := p.andOr()
+		if !ok {
+			p.rdp.Restore(b)
+			break
+		}
+
+		separated := true
+		if p.rdp.Accept(tokenIdentifierSemicolon) {
+			// do nothing, just a semicolon
+		} else if p.rdp.Accept(tokenIdentifierAnd) {
+			node = p.background(node, b)
+		} else if !p.newlineList() {
+			separated = false
+		}
+
+		nodes = append(nodes, node)
+
+		if !separated {
+			break
+		}
+
+		p.linebreak()
+	}
+
+	return nodes, len(nodes) > 0
+}
+
+// Wraps the node that was parsed from the tokens starting at the index provided
+// (and ending in the '&' token that was just accepted) with a Background node.
+func (p *Parser) background(node ast.Node, start int) *ast.Background {
+	background := ast.NewBackground(node)
+
+	values := []string{}
+	for _, token := range p.rdp.Tokens[start : p.rdp.Backup()-1] {
+		values = append(values, token.Value)
+	}
+
+	background.Text = strings.Join(values, " ")
+
+	return background
+}
+
 func (p *Parser) andOr() (node ast.Node, ok bool) {
 	b := p.rdp.Backup()
 
@@ -245,14 +334,24 @@ func (p *Parser) andOrBinaryType() (BinaryType ast.BinaryType, ok bool) {
 }
 
 // this represents both the pipeline and pipeline_sequence syntax because
-// it can be simplified if not using a recursion
+// it can be simplified if not using a recursion. The bang applies to the whole
+// pipeline:
+//
+//	pipeline : pipe_sequence
+//	         | Bang pipe_sequence
 func (p *Parser) pipeline() (ast.Node, bool) {
 	b := p.rdp.Backup()
 
+	not := p.acceptReservedWord(tokenIdentifierBang)
+
 	pipe := ast.NewPipe()
 
 	cmd, ok2 := p.command()
 	if !ok2 {
+		if not {
+			return nil, p.unexpected()
+		}
+
 		p.rdp.Restore(b)
 		return nil, false
 	}
@@ -282,17 +381,35 @@ func (p *Parser) pipeline() (ast.Node, bool) {
 		node = pipe.Commands[0]
 	}
 
+	if not {
+		node = ast.NewNot(node)
+	}
+
 	return node, true
 }
 
 func (p *Parser) command() (ast.Node, bool) {
 	// the first word of a command
+	p.substituteAlias()
+
 	b := p.rdp.Backup()
 	upgraded := p.rdp.Current().tryUpgradeToReservedWord()
 
-	not := p.rdp.Accept(tokenIdentifierBang)
+	node, ok := p.compoundCommand()
+	if ok {
+		node = p.redirectList(node)
+	} else if p.rdp.Error() == nil {
+		var funcNode *ast.FunctionDefinition
+		if funcNode, ok = p.functionDefinition(); ok {
+			node = funcNode
+		} else if p.rdp.Error() == nil {
+			var cmdNode *ast.SimpleCommand
+			if cmdNode, ok = p.simpleCommand(); ok {
+				node = cmdNode
+			}
+		}
+	}
 
-	cmdNode, ok := p.simpleCommand()
 	if !ok {
 		p.rdp.Restore(b)
 		// restore the upgraded token, if it was upgraded
@@ -303,14 +420,208 @@ func (p *Parser) command() (ast.Node, bool) {
 		return nil, false
 	}
 
-	node := ast.Node(cmdNode)
-	if not {
-		node = ast.NewNot(cmdNode)
+	return node, true
+}
+
+func (p *Parser) compoundCommand() (ast.Node, bool) {
+	if node, ok := p.braceGroup(); ok {
+		return node, true
+	}
+
+	if node, ok := p.subshell(); ok {
+		return node, true
+	}
+
+	if node, ok := p.ifClause(); ok {
+		return node, true
+	}
+
+	if node, ok := p.whileClause(); ok {
+		return node, true
+	}
+
+	if node, ok := p.untilClause(); ok {
+		return node, true
+	}
+
+	if node, ok := p.forClause(); ok {
+		return node, true
+	}
+
+	if node, ok := p.caseClause(); ok {
+		return node, true
+	}
+
+	return nil, false
+}
+
+// derived from the redirect_list grammar rule. Wraps the node with the
+// redirections that follow it, if there are any.
+//
+//	redirect_list : io_redirect
+//	              | redirect_list io_redirect
+func (p *Parser) redirectList(node ast.Node) ast.Node {
+	redirect := ast.NewRedirect(node)
+
+	for {
+		io, ok := p.ioRedirection()
+		if !ok {
+			break
+		}
+
+		redirect.Redirects = append(redirect.Redirects, io)
+	}
+
+	if len(redirect.Redirects) == 0 {
+		return node
+	}
+
+	return redirect
+}
+
+// derived from the function_definition and function_body grammar rules:
+//
+//	function_definition : fname '(' ')' linebreak function_body
+//	function_body       : compound_command
+//	                    | compound_command redirect_list
+func (p *Parser) functionDefinition() (*ast.FunctionDefinition, bool) {
+	b := p.rdp.Backup()
+
+	if !p.rdp.Check(tokenIdentifierWord) || !isName(p.rdp.Current().Value) {
+		return nil, false
+	}
+
+	name := p.rdp.Current().Value
+	p.rdp.Consume()
+
+	if !p.rdp.Accept(tokenIdentifierLParen) {
+		p.rdp.Restore(b)
+		return nil, false
+	}
+
+	if !p.rdp.Accept(tokenIdentifierRParen) {
+		return nil, p.unexpected()
+	}
+
+	p.linebreak()
+
+	body, ok := p.compoundCommand()
+	if !ok {
+		return nil, p.unexpected()
+	}
+
+	return ast.NewFunctionDefinition(name, p.redirectList(body)), true
+}
+
+// derived from the brace_group grammar rule:
+//
+//	brace_group : Lbrace compound_list Rbrace
+func (p *Parser) braceGroup() (*ast.BraceGroup, bool) {
+	if !p.acceptReservedWord(tokenIdentifierLBrace) {
+		return nil, false
+	}
+
+	node := ast.NewBraceGroup()
+
+	var ok bool
+	if node.Commands, ok = p.compoundList(); !ok {
+		return nil, p.unexpected()
+	}
+
+	if !p.expectReservedWord(tokenIdentifierRBrace) {
+		return nil, false
 	}
 
 	return node, true
 }
 
+// derived from the subshell grammar rule:
+//
+//	subshell : '(' compound_list ')'
+func (p *Parser) subshell() (*ast.Subshell, bool) {
+	if !p.rdp.Accept(tokenIdentifierLParen) {
+		return nil, false
+	}
+
+	node := ast.NewSubshell()
+
+	var ok bool
+	if node.Commands, ok = p.compoundList(); !ok {
+		return nil, p.unexpected()
+	}
+
+	if !p.rdp.Accept(tokenIdentifierRParen) {
+		return nil, p.unexpected()
+	}
+
+	return node, true
+}
+
+// derived from the if_clause grammar rule:
+//
+//	if_clause : If compound_list Then compound_list else_part Fi
+//	          | If compound_list Then compound_list           Fi
+func (p *Parser) ifClause() (*ast.If, bool) {
+	if !p.acceptReservedWord(tokenIdentifierIf) {
+		return nil, false
+	}
+
+	node := ast.NewIf()
+
+	if !p.ifBody(node) {
+		return nil, false
+	}
+
+	if !p.expectReservedWord(tokenIdentifierFi) {
+		return nil, false
+	}
+
+	return node, true
+}
+
+// parses the `compound_list Then compound_list else_part` part that is shared
+// by if_clause and the elif form of else_part
+func (p *Parser) ifBody(node *ast.If) bool {
+	var ok bool
+
+	if node.Condition, ok = p.compoundList(); !ok {
+		return p.unexpected()
+	}
+
+	if !p.expectReservedWord(tokenIdentifierThen) {
+		return false
+	}
+
+	if node.Then, ok = p.compoundList(); !ok {
+		return p.unexpected()
+	}
+
+	return p.elsePart(node)
+}
+
+// derived from the else_part grammar rule:
+//
+//	else_part : Elif compound_list Then compound_list
+//	          | Elif compound_list Then compound_list else_part
+//	          | Else compound_list
+func (p *Parser) elsePart(node *ast.If) bool {
+	if p.acceptReservedWord(tokenIdentifierElif) {
+		elif := ast.NewIf()
+		node.Else = []ast.Node{elif}
+
+		return p.ifBody(elif)
+	}
+
+	if p.acceptReservedWord(tokenIdentifierElse) {
+		var ok bool
+		if node.Else, ok = p.compoundList(); !ok {
+			return p.unexpected()
+		}
+	}
+
+	return true
+}
+
 func (p *Parser) simpleCommand() (node *ast.SimpleCommand, ok bool) {
 	c := ast.NewSimpleCommand()
 
@@ -345,17 +656,18 @@ func (p *Parser) cmdPrefix(cmd *ast.SimpleCommand) (ok bool) {
 }
 
 func (p *Parser) cmdWord(cmd *ast.SimpleCommand) bool {
+	p.substituteAlias()
+
 	if !p.rdp.Check(tokenIdentifierWord) {
 		return false
 	}
 
-	e := NewExpander(p.rdp.Current().Value)
-	if err := e.Parse(); err != nil {
+	word, ok := p.word()
+	if !ok {
 		return false
 	}
 
-	cmd.Word = e.Expr
-	p.rdp.Consume()
+	cmd.Word = word
 
 	return true
 }
@@ -380,13 +692,12 @@ func (p *Parser) ioRedirectOrArg(cmd *ast.SimpleCommand) bool {
 		return true
 	}
 
-	if p.rdp.Accept(tokenIdentifierWord) {
-		e := NewExpander(p.rdp.Prev().Value)
-		if err := e.Parse(); err != nil {
-			return false
-		}
+	if p.rdp.Current().afterAlias {
+		p.substituteAlias()
+	}
 
-		cmd.AddArgument(e.Expr)
+	if word, ok := p.word(); ok {
+		cmd.AddArgument(word)
 		return true
 	}
 
@@ -395,17 +706,27 @@ func (p *Parser) ioRedirectOrArg(cmd *ast.SimpleCommand) bool {
 }
 
 func (p *Parser) cmdName(cmd *ast.SimpleCommand) bool {
-	e := NewExpander(p.rdp.Current().Value)
-	if err := e.Parse(); err != nil {
+	word, ok := p.word()
+	if !ok {
 		return false
 	}
 
-	cmd.Word = e.Expr
+	cmd.Word = word
 
-	return p.rdp.Accept(tokenIdentifierWord)
+	return true
 }
 
 func (p *Parser) ioRedirect(cmd *ast.SimpleCommand) (ok bool) {
+	a, ok := p.ioRedirection()
+	if ok {
+		cmd.Redirects = append(cmd.Redirects, a)
+	}
+
+	return ok
+}
+
+// derived from the io_redirect grammar rule
+func (p *Parser) ioRedirection() (*ast.IORedirection, bool) {
 	b := p.rdp.Backup()
 
 	a := &ast.IORedirection{}
@@ -417,7 +738,9 @@ func (p *Parser) ioRedirect(cmd *ast.SimpleCommand) (ok bool) {
 	}
 
 	fdAsserted := 0
-	if p.rdp.Accept(tokenIdentifierLess, tokenIdentifierLessAnd) { // <
+	if p.rdp.Accept(tokenIdentifierDLess, tokenIdentifierDLessDash) {
+		return p.ioHere(a, fdSet)
+	} else if p.rdp.Accept(tokenIdentifierLess, tokenIdentifierLessAnd) { // <
 		fdAsserted = 0
 	} else if p.rdp.Accept(tokenIdentifierGreat, tokenIdentifierDGreat, tokenIdentifierGreatAnd, tokenIdentifierClobber) {
 		fdAsserted = 1
@@ -425,24 +748,384 @@ func (p *Parser) ioRedirect(cmd *ast.SimpleCommand) (ok bool) {
 		// nothing
 	} else {
 		p.rdp.Restore(b)
-		return false
+		return nil, false
 	}
 
 	a.Mode = ast.IORedirectionMode(p.rdp.Prev().Value)
 
-	a.Value = ast.NewExprStr(p.rdp.Current().Value)
-
 	to := fdAsserted
 	if fdSet != nil {
 		to = *fdSet
 	}
 
 	a.Fd = to
-	cmd.Redirects = append(cmd.Redirects, a)
+
+	if !p.rdp.Check(tokenIdentifierWord) {
+		return nil, p.unexpected()
+	}
+
+	var ok bool
+	if a.Value, ok = p.word(); !ok {
+		return nil, false
+	}
+
+	return a, true
+}
+
+// derived from the io_here grammar rule. The body of the here-document is the
+// value of the redirection, expanded unless a part of the delimiter is quoted.
+func (p *Parser) ioHere(a *ast.IORedirection, fdSet *int) (*ast.IORedirection, bool) {
+	a.Mode = ast.IORedirectionMode(p.rdp.Prev().Value)
+
+	a.Fd = 0
+	if fdSet != nil {
+		a.Fd = *fdSet
+	}
+
+	if !p.rdp.Check(tokenIdentifierWord) {
+		return nil, p.unexpected()
+	}
+
+	body := p.rdp.Current().HereDoc
+	if _, quoted := hereDocDelimiter(p.rdp.Current().Value); quoted {
+		a.Value = ast.NewExpr(ast.NewSingleQuote(body))
+	} else {
+		e := NewExpander(body)
+		if err := e.ParseHereDoc(); err != nil {
+			p.rdp.SetError(err)
+			return nil, false
+		}
+
+		a.Value = e.Expr
+	}
 
 	p.rdp.Consume()
 
-	return true
+	return a, true
+}
+
+// derived from the while_clause grammar rule:
+//
+//	while_clause : While compound_list do_group
+func (p *Parser) whileClause() (*ast.While, bool) {
+	if !p.acceptReservedWord(tokenIdentifierWhile) {
+		return nil, false
+	}
+
+	node := ast.NewWhile()
+
+	var ok bool
+	if node.Condition, ok = p.compoundList(); !ok {
+		return nil, p.unexpected()
+	}
+
+	if node.Body, ok = p.doGroup(); !ok {
+		return nil, false
+	}
+
+	return node, true
+}
+
+// derived from the until_clause grammar rule:
+//
+//	until_clause : Until compound_list do_group
+func (p *Parser) untilClause() (*ast.Until, bool) {
+	if !p.acceptReservedWord(tokenIdentifierUntil) {
+		return nil, false
+	}
+
+	node := ast.NewUntil()
+
+	var ok bool
+	if node.Condition, ok = p.compoundList(); !ok {
+		return nil, p.unexpected()
+	}
+
+	if node.Body, ok = p.doGroup(); !ok {
+		return nil, false
+	}
+
+	return node, true
+}
+
+// derived from the for_clause grammar rule:
+//
+//	for_clause : For name                                      do_group
+//	           | For name                       sequential_sep do_group
+//	           | For name linebreak in          sequential_sep do_group
+//	           | For name linebreak in wordlist sequential_sep do_group
+func (p *Parser) forClause() (*ast.For, bool) {
+	if !p.acceptReservedWord(tokenIdentifierFor) {
+		return nil, false
+	}
+
+	if !p.rdp.Check(tokenIdentifierWord) || !isName(p.rdp.Current().Value) {
+		return nil, p.unexpected()
+	}
+
+	node := ast.NewFor(p.rdp.Current().Value)
+	p.rdp.Consume()
+
+	b := p.rdp.Backup()
+	p.linebreak()
+
+	if p.acceptReservedWord(tokenIdentifierIn) {
+		node.Words = []*ast.Expr{}
+
+		for p.rdp.Check(tokenIdentifierWord) {
+			word, ok := p.word()
+			if !ok {
+				return nil, false
+			}
+
+			node.Words = append(node.Words, word)
+		}
+
+		if !p.sequentialSeparator() {
+			return nil, p.unexpected()
+		}
+	} else {
+		p.rdp.Restore(b)
+		p.sequentialSeparator()
+	}
+
+	var ok bool
+	if node.Body, ok = p.doGroup(); !ok {
+		return nil, false
+	}
+
+	return node, true
+}
+
+// derived from the sequential_sep grammar rule:
+//
+//	sequential_sep : ';' linebreak
+//	               | newline_list
+func (p *Parser) sequentialSeparator() bool {
+	if p.rdp.Accept(tokenIdentifierSemicolon) {
+		return p.linebreak()
+	}
+
+	return p.newlineList()
+}
+
+// derived from the case_clause grammar rule:
+//
+//	case_clause : Case WORD linebreak in linebreak case_list    Esac
+//	            | Case WORD linebreak in linebreak case_list_ns Esac
+//	            | Case WORD linebreak in linebreak              Esac
+//
+// the case_list and case_list_ns rules are flattened into a list of items where
+// the DSEMI of the last item is optional.
+func (p *Parser) caseClause() (*ast.Case, bool) {
+	if !p.acceptReservedWord(tokenIdentifierCase) {
+		return nil, false
+	}
+
+	word, ok := p.word()
+	if !ok {
+		return nil, p.unexpected()
+	}
+
+	node := ast.NewCase(word)
+
+	p.linebreak()
+
+	if !p.expectReservedWord(tokenIdentifierIn) {
+		return nil, false
+	}
+
+	p.linebreak()
+
+	for !p.acceptReservedWord(tokenIdentifierEsac) {
+		item, ok := p.caseItem()
+		if !ok {
+			return nil, p.unexpected()
+		}
+
+		node.Items = append(node.Items, item)
+
+		if !p.rdp.Accept(tokenIdentifierDSemicolon) {
+			if !p.expectReservedWord(tokenIdentifierEsac) {
+				return nil, false
+			}
+
+			break
+		}
+
+		p.linebreak()
+	}
+
+	return node, true
+}
+
+// derived from the case_item and case_item_ns grammar rules (without the DSEMI):
+//
+//	case_item_ns :     pattern ')' linebreak
+//	             |     pattern ')' compound_list
+//	             | '(' pattern ')' linebreak
+//	             | '(' pattern ')' compound_list
+//	pattern      : WORD
+//	             | pattern '|' WORD
+func (p *Parser) caseItem() (*ast.CaseItem, bool) {
+	item := ast.NewCaseItem()
+
+	p.rdp.Accept(tokenIdentifierLParen)
+
+	for {
+		pattern, ok := p.word()
+		if !ok {
+			return nil, false
+		}
+
+		item.Patterns = append(item.Patterns, pattern)
+
+		if !p.rdp.Accept(tokenIdentifierPipe) {
+			break
+		}
+	}
+
+	if !p.rdp.Accept(tokenIdentifierRParen) {
+		return nil, false
+	}
+
+	// an empty compound list still consumes the linebreak
+	item.Body, _ = p.compoundList()
+
+	return item, true
+}
+
+// derived from the do_group grammar rule:
+//
+//	do_group : Do compound_list Done
+func (p *Parser) doGroup() ([]ast.Node, bool) {
+	if !p.expectReservedWord(tokenIdentifierDo) {
+		return nil, false
+	}
+
+	nodes, ok := p.compoundList()
+	if !ok {
+		return nil, p.unexpected()
+	}
+
+	if !p.expectReservedWord(tokenIdentifierDone) {
+		return nil, false
+	}
+
+	return nodes, true
+}
+
+// Parses the current word token into an expression and consumes it
+func (p *Parser) word() (*ast.Expr, bool) {
+	if p.rdp.Error() != nil || !p.rdp.Check(tokenIdentifierWord) {
+		return nil, false
+	}
+
+	e := NewExpander(p.rdp.Current().Value)
+	if err := e.Parse(); err != nil {
+		p.rdp.SetError(err)
+		return nil, false
+	}
+
+	p.rdp.Consume()
+
+	return e.Expr, true
+}
+
+// Replaces the current token, if it is the name of an alias, with the tokens of
+// the value of the alias (see 2.3.1 Alias Substitution). The value is checked
+// again for aliases, except for the ones that were already substituted. If the
+// value ends with a blank, the word that follows is also checked for aliases.
+func (p *Parser) substituteAlias() {
+	for p.rdp.Error() == nil {
+		current := p.rdp.Current()
+		if !current.Is(tokenIdentifierWord) {
+			return
+		}
+
+		name := current.Value
+		value, ok := p.Settings.Aliases[name]
+		if !ok || current.aliases[name] {
+			return
+		}
+
+		tokens, err := NewTokenizerShort(value).ReadAll()
+		if err != nil {
+			p.rdp.SetError(err)
+			return
+		}
+
+		// the EOF token of the value
+		tokens = tokens[:len(tokens)-1]
+
+		aliases := map[string]bool{name: true}
+		for k := range current.aliases {
+			aliases[k] = true
+		}
+
+		for _, token := range tokens {
+			token.aliases = aliases
+		}
+
+		i := p.rdp.Backup()
+		rest := p.rdp.Tokens[i+1:]
+		p.rdp.Tokens = append(append(p.rdp.Tokens[:i:i], tokens...), rest...)
+
+		if value != "" && isBlank(rune(value[len(value)-1])) {
+			p.rdp.Tokens[i+len(tokens)].afterAlias = true
+		}
+	}
+}
+
+// Accepts the current token if it is the reserved word provided. Reserved words
+// are context-dependent, so a word token is accepted if its value matches.
+func (p *Parser) acceptReservedWord(word TokenIdentifier) bool {
+	if p.rdp.Error() != nil {
+		return false
+	}
+
+	current := p.rdp.Current()
+	if !current.Is(word) && !(current.Is(tokenIdentifierWord) && current.Value == word.String()) {
+		return false
+	}
+
+	return p.rdp.Consume() == nil
+}
+
+// Like acceptReservedWord, but sets a syntax error if the reserved word is missing
+func (p *Parser) expectReservedWord(word TokenIdentifier) bool {
+	if p.acceptReservedWord(word) {
+		return true
+	}
+
+	if p.rdp.Error() == nil {
+		p.rdp.SetError(newSyntaxError(fmt.Errorf("expected %s but found %s", word, p.found())))
+	}
+
+	return false
+}
+
+// Sets a syntax error about the current token and returns false
+func (p *Parser) unexpected() bool {
+	if p.rdp.Error() == nil {
+		p.rdp.SetError(newSyntaxError(fmt.Errorf("unexpected %s", p.found())))
+	}
+
+	return false
+}
+
+// Returns a description of the current token to be used in syntax errors
+func (p *Parser) found() string {
+	current := p.rdp.Current()
+	if current.Is(tokenIdentifierWord) || current.Is(tokenIdentifierAssignmentWord) {
+		return current.Value
+	}
+
+	if current.Is(tokenIdentifierNewline) {
+		return "newline"
+	}
+
+	return current.Identifier.String()
 }
 
 func (p *Parser) linebreak() bool {
@@ -473,10 +1156,16 @@ func (p *Parser) assignmentWord() (string, *ast.Expr, bool) {
 		v := p.rdp.Current().Value
 		i := strings.IndexRune(v, '=')
 		key := v[:i]
-		value := v[i+1:]
+
+		e := NewAssignmentExpander(v[i+1:])
+		if err := e.Parse(); err != nil {
+			p.rdp.SetError(err)
+			return "", nil, false
+		}
+
 		p.rdp.Consume()
 
-		return key, ast.NewExprStr(value), true
+		return key, e.Expr, true
 	}
 
 	return "", nil, false
@@ -48,7 +48,7 @@ ls&x;ls&
 				Left: &ast.Pipe{
 					Commands: []ast.Node{
 						&ast.SimpleCommand{
-							Word: ast.NewExprStr("'c'"),
+							Word: ast.NewExpr(ast.NewSingleQuote("c")),
 							Redirects: []*ast.IORedirection{
 								{
 									Fd:    1,
@@ -86,6 +86,147 @@ ls&x;ls&
 	})
 }
 
+func TestParserHereDoc(t *testing.T) {
+	p := parseDefaultText(t, "a <<EOF 2<<-'EOF'\n$x \"y\"\nEOF\n\t$x\n\tEOF\nb")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.SimpleCommand{
+				Word: ast.NewExprStr("a"),
+				Redirects: []*ast.IORedirection{
+					{
+						Fd:   0,
+						Mode: ast.IORedirectionModeHereDoc,
+						Value: ast.NewExpr(ast.NewDoubleQuote(
+							&ast.Param{Name: "x"},
+							ast.NewString(" \"y\"\n"),
+						)),
+					},
+					{
+						Fd:    2,
+						Mode:  ast.IORedirectionModeHereDocStrip,
+						Value: ast.NewExpr(ast.NewSingleQuote("$x\n")),
+					},
+				},
+			},
+			&ast.SimpleCommand{Word: ast.NewExprStr("b")},
+		},
+	})
+
+	parserTestError(t, "a <<\n")
+	parserTestError(t, "a >\n")
+	parserTestError(t, "a 2>&;")
+}
+
+func TestParserAlias(t *testing.T) {
+	aliases := map[string]string{
+		"ll":    "ls -l",
+		"ls":    "ls --color",
+		"a":     "b",
+		"b":     "a x",
+		"cmd":   "echo ",
+		"word":  "w",
+		"loop":  "for i in 1; do",
+		"quiet": "2>/dev/null ll",
+	}
+
+	parse := func(text string) *Parser {
+		tokenizer := NewTokenizerShort(text)
+		tokens, err := tokenizer.ReadAll()
+		require.NoError(t, err)
+
+		parser := NewParser(tokens, ParserSettings{Aliases: aliases})
+		require.NoError(t, parser.Parse(), text)
+
+		return parser
+	}
+
+	simple := func(words ...string) *ast.SimpleCommand {
+		args := []*ast.Expr{}
+		for _, w := range words[1:] {
+			args = append(args, ast.NewExprStr(w))
+		}
+
+		return &ast.SimpleCommand{Word: ast.NewExprStr(words[0]), Args: args}
+	}
+
+	// aliases are substituted recursively, but not in their own value
+	requireNode(t, parse("ll x; ls").AST(), &ast.Program{
+		Commands: []ast.Node{simple("ls", "--color", "-l", "x"), simple("ls", "--color")},
+	})
+	requireNode(t, parse("a").AST(), &ast.Program{Commands: []ast.Node{simple("a", "x")}})
+
+	// only command words are substituted, unless an alias ends with a blank
+	requireNode(t, parse("echo ll; X=1 ll 'll' \\ll").AST(), &ast.Program{
+		Commands: []ast.Node{
+			simple("echo", "ll"),
+			&ast.SimpleCommand{
+				Word:        ast.NewExprStr("ls"),
+				Args:        []*ast.Expr{ast.NewExprStr("--color"), ast.NewExprStr("-l"), ast.NewExpr(ast.NewSingleQuote("ll")), ast.NewExpr(ast.NewEscaped("l"), ast.NewString("l"))},
+				Assignments: map[string]*ast.Expr{"X": ast.NewExprStr("1")},
+			},
+		},
+	})
+	requireNode(t, parse("cmd word word").AST(), &ast.Program{Commands: []ast.Node{simple("echo", "w", "word")}})
+	requireNode(t, parse("cmd cmd word").AST(), &ast.Program{Commands: []ast.Node{simple("echo", "echo", "w")}})
+
+	// aliases can contain reserved words and redirections
+	requireNode(t, parse("loop ll; done").AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.For{Name: "i", Words: []*ast.Expr{ast.NewExprStr("1")}, Body: []ast.Node{simple("ls", "--color", "-l")}},
+		},
+	})
+	requireNode(t, parse("quiet").AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.SimpleCommand{
+				Word: ast.NewExprStr("ls"),
+				Args: []*ast.Expr{ast.NewExprStr("--color"), ast.NewExprStr("-l")},
+				Redirects: []*ast.IORedirection{
+					{Fd: 2, Mode: ast.IORedirectionModeOutput, Value: ast.NewExprStr("/dev/null")},
+				},
+			},
+		},
+	})
+}
+
+func TestParserBackground(t *testing.T) {
+	p := parseDefaultText(t, "a x | b > y & c\nif d; then e; fi &\n{ f & }")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.Background{
+				Child: &ast.Pipe{
+					Commands: []ast.Node{
+						&ast.SimpleCommand{Word: ast.NewExprStr("a"), Args: []*ast.Expr{ast.NewExprStr("x")}},
+						&ast.SimpleCommand{
+							Word: ast.NewExprStr("b"),
+							Redirects: []*ast.IORedirection{
+								{Fd: 1, Mode: ast.IORedirectionModeOutput, Value: ast.NewExprStr("y")},
+							},
+						},
+					},
+				},
+			},
+			&ast.SimpleCommand{Word: ast.NewExprStr("c")},
+			&ast.Background{
+				Child: &ast.If{
+					Condition: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("d")}},
+					Then:      []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("e")}},
+				},
+			},
+			&ast.BraceGroup{
+				Commands: []ast.Node{
+					&ast.Background{Child: &ast.SimpleCommand{Word: ast.NewExprStr("f")}},
+				},
+			},
+		},
+	})
+
+	// the text of the commands is kept for the jobs built-in
+	commands := p.Program().Commands
+	require.Equal(t, "a x | b > y", commands[0].(*ast.Background).Text)
+	require.Equal(t, "if d ; then e ; fi", commands[2].(*ast.Background).Text)
+	require.Equal(t, "f", commands[3].(*ast.BraceGroup).Commands[0].(*ast.Background).Text)
+}
+
 func TestParserNot(t *testing.T) {
 	p := parseDefaultText(t, "x;! y")
 	requireNode(t, p.AST(), &ast.Program{
@@ -96,6 +237,37 @@ func TestParserNot(t *testing.T) {
 	})
 }
 
+func TestParserNotPipeline(t *testing.T) {
+	parserTest(t, "! a && ! b || ! { c; }")
+	parserTest(t, "if ! a; then ! b; fi")
+	parserTest(t, "echo !")
+	parserTestError(t, "!")
+	parserTestError(t, "! ;")
+	parserTestError(t, "a | ! b")
+
+	p := parseDefaultText(t, "! x | y && ! (z)")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.Binary{
+				Left: &ast.Not{
+					Child: &ast.Pipe{
+						Commands: []ast.Node{
+							&ast.SimpleCommand{Word: ast.NewExprStr("x")},
+							&ast.SimpleCommand{Word: ast.NewExprStr("y")},
+						},
+					},
+				},
+				Type: ast.BinaryTypeAnd,
+				Right: &ast.Not{
+					Child: &ast.Subshell{
+						Commands: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("z")}},
+					},
+				},
+			},
+		},
+	})
+}
+
 func TestParserASTArguments(t *testing.T) {
 	p := parseDefaultText(t, `A=1 x a b c | y a <1 b c`)
 	requireNode(t, p.AST(), &ast.Program{
@@ -188,6 +360,240 @@ func TestParserASTRedirects(t *testing.T) {
 	})
 }
 
+func TestParserIf(t *testing.T) {
+	parserTest(t, "if a; then b; fi")
+	parserTest(t, "if a\nthen\nb\nfi")
+	parserTest(t, "if a; b; then c; d; elif e; then f; else g; fi")
+	parserTest(t, "if a; then if b; then c; fi; fi")
+	parserTest(t, "if a; then b; fi && c; d")
+	parserTest(t, "echo if then fi")
+	parserTestError(t, "if a; then b")
+	parserTestError(t, "if a; fi")
+	parserTestError(t, "if a; then fi")
+	parserTestError(t, "if; then b; fi")
+	parserTestError(t, "if a; then b; fi c")
+	parserTestError(t, "fi")
+
+	p := parseDefaultText(t, `
+if a
+then
+	b; c
+elif d; then e
+else f
+fi
+`)
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.If{
+				Condition: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("a")}},
+				Then: []ast.Node{
+					&ast.SimpleCommand{Word: ast.NewExprStr("b")},
+					&ast.SimpleCommand{Word: ast.NewExprStr("c")},
+				},
+				Else: []ast.Node{
+					&ast.If{
+						Condition: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("d")}},
+						Then:      []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("e")}},
+						Else:      []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("f")}},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestParserLoops(t *testing.T) {
+	parserTest(t, "while a; do b; done")
+	parserTest(t, "until a; do b; done")
+	parserTest(t, "while a\ndo\nb\ndone")
+	parserTest(t, "while a; b; do c; d; done")
+	parserTest(t, "while a; do until b; do c; done; done")
+	parserTest(t, "while a; do break; continue 2; done | c")
+	parserTest(t, "echo while do done")
+	parserTestError(t, "while a; done")
+	parserTestError(t, "while a; do b")
+	parserTestError(t, "while a; do done")
+	parserTestError(t, "until; do b; done")
+	parserTestError(t, "done")
+
+	p := parseDefaultText(t, "while a; do b; c; done\nuntil d\ndo\ne\ndone")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.While{
+				Condition: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("a")}},
+				Body: []ast.Node{
+					&ast.SimpleCommand{Word: ast.NewExprStr("b")},
+					&ast.SimpleCommand{Word: ast.NewExprStr("c")},
+				},
+			},
+			&ast.Until{
+				Condition: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("d")}},
+				Body:      []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("e")}},
+			},
+		},
+	})
+}
+
+func TestParserFor(t *testing.T) {
+	parserTest(t, "for i do a; done")
+	parserTest(t, "for i; do a; done")
+	parserTest(t, "for i\ndo a; done")
+	parserTest(t, "for i in; do a; done")
+	parserTest(t, "for i in a b c; do a; done")
+	parserTest(t, "for i\nin a b c\ndo\na\ndone")
+	parserTest(t, "for i in `echo a`; do for j in b; do c; done; done")
+	parserTest(t, "echo for in")
+	parserTestError(t, "for; do a; done")
+	parserTestError(t, "for 1i in a; do a; done")
+	parserTestError(t, "for i in a b do a; done")
+	parserTestError(t, "for i in a; a; done")
+
+	p := parseDefaultText(t, "for i in a b; do c; done\nfor j\ndo d; done\nfor k in; do e; done")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.For{
+				Name:  "i",
+				Words: []*ast.Expr{ast.NewExprStr("a"), ast.NewExprStr("b")},
+				Body:  []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("c")}},
+			},
+			&ast.For{
+				Name:  "j",
+				Words: nil,
+				Body:  []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("d")}},
+			},
+			&ast.For{
+				Name:  "k",
+				Words: []*ast.Expr{},
+				Body:  []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("e")}},
+			},
+		},
+	})
+}
+
+func TestParserCase(t *testing.T) {
+	parserTest(t, "case a in esac")
+	parserTest(t, "case a in\nesac")
+	parserTest(t, "case a\nin\nesac")
+	parserTest(t, "case a in b) c;; esac")
+	parserTest(t, "case a in b) c; esac")
+	parserTest(t, "case a in b) c\nesac")
+	parserTest(t, "case a in b) esac")
+	parserTest(t, "case a in b) ;; esac")
+	parserTest(t, "case a in (b) c;; (d) e;; esac")
+	parserTest(t, "case a in b|c|d) e;; *) f;; esac")
+	parserTest(t, "case a in\nb)\nc\nd\n;;\ne)\nf\n;;\nesac")
+	parserTest(t, "case a in (esac) b;; esac")
+	parserTest(t, "case a in b) case c in d) e;; esac;; esac")
+	parserTest(t, "echo case in esac")
+	parserTestError(t, "case a in b) c;;")
+	parserTestError(t, "case a in b c;; esac")
+	parserTestError(t, "case a b) c;; esac")
+	parserTestError(t, "case a in b) c;; d) e f esac")
+	parserTestError(t, "case in esac")
+	parserTestError(t, "esac")
+
+	p := parseDefaultText(t, "case a in\n(b | c) d; e;;\nf) esac")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.Case{
+				Word: ast.NewExprStr("a"),
+				Items: []*ast.CaseItem{
+					{
+						Patterns: []*ast.Expr{ast.NewExprStr("b"), ast.NewExprStr("c")},
+						Body: []ast.Node{
+							&ast.SimpleCommand{Word: ast.NewExprStr("d")},
+							&ast.SimpleCommand{Word: ast.NewExprStr("e")},
+						},
+					},
+					{
+						Patterns: []*ast.Expr{ast.NewExprStr("f")},
+						Body:     []ast.Node{},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestParserGroups(t *testing.T) {
+	parserTest(t, "{ a; }")
+	parserTest(t, "{ a; b\n}")
+	parserTest(t, "{\na\nb\n}")
+	parserTest(t, "(a)")
+	parserTest(t, "( a; b )")
+	parserTest(t, "(\na\n)")
+	parserTest(t, "{ (a); { b; }; } | (c) && { d; }")
+	parserTest(t, "{ a; } > x 2>&1")
+	parserTest(t, "if a; then b; fi > x")
+	parserTest(t, "while a; do b; done < x | c")
+	parserTest(t, "echo { }")
+	parserTestError(t, "{ a }")
+	parserTestError(t, "{ }")
+	parserTestError(t, "{ a; } b")
+	parserTestError(t, "( a")
+	parserTestError(t, "()")
+	parserTestError(t, "(a) b")
+	parserTestError(t, "}")
+
+	p := parseDefaultText(t, "{ a; b; } > x\n(c) 2>&1")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.Redirect{
+				Child: &ast.BraceGroup{
+					Commands: []ast.Node{
+						&ast.SimpleCommand{Word: ast.NewExprStr("a")},
+						&ast.SimpleCommand{Word: ast.NewExprStr("b")},
+					},
+				},
+				Redirects: []*ast.IORedirection{
+					{Fd: 1, Mode: ast.IORedirectionModeOutput, Value: ast.NewExprStr("x")},
+				},
+			},
+			&ast.Redirect{
+				Child: &ast.Subshell{
+					Commands: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("c")}},
+				},
+				Redirects: []*ast.IORedirection{
+					{Fd: 2, Mode: ast.IORedirectionModeOutputFd, Value: ast.NewExprStr("1")},
+				},
+			},
+		},
+	})
+}
+
+func TestParserFunctions(t *testing.T) {
+	parserTest(t, "f() { a; }")
+	parserTest(t, "f ( ) { a; }")
+	parserTest(t, "f()\n{\na\n}")
+	parserTest(t, "f() (a)")
+	parserTest(t, "f() if a; then b; fi")
+	parserTest(t, "f() { a; } > x; f")
+	parserTest(t, "f() { g() { a; }; }")
+	parserTestError(t, "f() a")
+	parserTestError(t, "f()")
+	parserTestError(t, "f(")
+	parserTestError(t, "f() { a; } b")
+	parserTestError(t, "1f() { a; }")
+
+	p := parseDefaultText(t, "f() { a; } 2> x\nf")
+	requireNode(t, p.AST(), &ast.Program{
+		Commands: []ast.Node{
+			&ast.FunctionDefinition{
+				Name: "f",
+				Body: &ast.Redirect{
+					Child: &ast.BraceGroup{
+						Commands: []ast.Node{&ast.SimpleCommand{Word: ast.NewExprStr("a")}},
+					},
+					Redirects: []*ast.IORedirection{
+						{Fd: 2, Mode: ast.IORedirectionModeOutput, Value: ast.NewExprStr("x")},
+					},
+				},
+			},
+			&ast.SimpleCommand{Word: ast.NewExprStr("f")},
+		},
+	})
+}
+
 func TestParserEmptyScript(t *testing.T) {
 	p := parseDefaultText(t, "")
 	requireNode(t, p.AST(), &ast.Program{Commands: []ast.Node{}})
@@ -235,11 +641,114 @@ func requireNode(t *testing.T, actual ast.Node, expected ast.Node) {
 		requireBackground(t, actual, a)
 	case *ast.Not:
 		requireNot(t, actual, a)
+	case *ast.If:
+		requireIf(t, actual, a)
+	case *ast.While:
+		requireWhile(t, actual, a)
+	case *ast.Until:
+		requireUntil(t, actual, a)
+	case *ast.For:
+		requireFor(t, actual, a)
+	case *ast.Case:
+		requireCase(t, actual, a)
+	case *ast.BraceGroup:
+		requireBraceGroup(t, actual, a)
+	case *ast.Subshell:
+		requireSubshell(t, actual, a)
+	case *ast.Redirect:
+		requireRedirect(t, actual, a)
+	case *ast.FunctionDefinition:
+		requireFunctionDefinition(t, actual, a)
 	default:
 		require.Nil(t, actual)
 		require.Nil(t, expected)
 	}
 }
+func requireNodes(t *testing.T, actual []ast.Node, expected []ast.Node) {
+	require.Len(t, actual, len(expected))
+
+	for i := range expected {
+		requireNode(t, actual[i], expected[i])
+	}
+}
+
+func requireIf(t *testing.T, node ast.Node, expectedIf *ast.If) {
+	require.IsType(t, node, &ast.If{})
+	n := node.(*ast.If)
+
+	requireNodes(t, n.Condition, expectedIf.Condition)
+	requireNodes(t, n.Then, expectedIf.Then)
+	requireNodes(t, n.Else, expectedIf.Else)
+}
+
+func requireWhile(t *testing.T, node ast.Node, expectedWhile *ast.While) {
+	require.IsType(t, node, &ast.While{})
+	n := node.(*ast.While)
+
+	requireNodes(t, n.Condition, expectedWhile.Condition)
+	requireNodes(t, n.Body, expectedWhile.Body)
+}
+
+func requireUntil(t *testing.T, node ast.Node, expectedUntil *ast.Until) {
+	require.IsType(t, node, &ast.Until{})
+	n := node.(*ast.Until)
+
+	requireNodes(t, n.Condition, expectedUntil.Condition)
+	requireNodes(t, n.Body, expectedUntil.Body)
+}
+
+func requireFor(t *testing.T, node ast.Node, expectedFor *ast.For) {
+	require.IsType(t, node, &ast.For{})
+	n := node.(*ast.For)
+
+	require.Equal(t, expectedFor.Name, n.Name)
+	require.Equal(t, expectedFor.Words, n.Words)
+	requireNodes(t, n.Body, expectedFor.Body)
+}
+
+func requireCase(t *testing.T, node ast.Node, expectedCase *ast.Case) {
+	require.IsType(t, node, &ast.Case{})
+	n := node.(*ast.Case)
+
+	require.Equal(t, expectedCase.Word, n.Word)
+	require.Len(t, n.Items, len(expectedCase.Items))
+
+	for i := range expectedCase.Items {
+		require.Equal(t, expectedCase.Items[i].Patterns, n.Items[i].Patterns)
+		requireNodes(t, n.Items[i].Body, expectedCase.Items[i].Body)
+	}
+}
+
+func requireBraceGroup(t *testing.T, node ast.Node, expectedGroup *ast.BraceGroup) {
+	require.IsType(t, node, &ast.BraceGroup{})
+	n := node.(*ast.BraceGroup)
+
+	requireNodes(t, n.Commands, expectedGroup.Commands)
+}
+
+func requireSubshell(t *testing.T, node ast.Node, expectedSubshell *ast.Subshell) {
+	require.IsType(t, node, &ast.Subshell{})
+	n := node.(*ast.Subshell)
+
+	requireNodes(t, n.Commands, expectedSubshell.Commands)
+}
+
+func requireRedirect(t *testing.T, node ast.Node, expectedRedirect *ast.Redirect) {
+	require.IsType(t, node, &ast.Redirect{})
+	n := node.(*ast.Redirect)
+
+	requireNode(t, n.Child, expectedRedirect.Child)
+	require.Equal(t, expectedRedirect.Redirects, n.Redirects)
+}
+
+func requireFunctionDefinition(t *testing.T, node ast.Node, expectedFunction *ast.FunctionDefinition) {
+	require.IsType(t, node, &ast.FunctionDefinition{})
+	n := node.(*ast.FunctionDefinition)
+
+	require.Equal(t, expectedFunction.Name, n.Name)
+	requireNode(t, n.Body, expectedFunction.Body)
+}
+
 func requireNot(t *testing.T, node ast.Node, not *ast.Not) {
 	require.IsType(t, node, &ast.Not{})
 	n := node.(*ast.Not)
@@ -289,6 +798,10 @@ func requireSimpleCmd(t *testing.T, node ast.Node, expectedCmd *ast.SimpleComman
 	require.IsType(t, node, &ast.SimpleCommand{})
 	cmd := node.(*ast.SimpleCommand)
 	require.Equal(t, expectedCmd.Word, cmd.Word)
+	require.Len(t, cmd.Args, len(expectedCmd.Args))
+	for i := range expectedCmd.Args {
+		require.Equal(t, expectedCmd.Args[i], cmd.Args[i])
+	}
 	require.Len(t, cmd.Assignments, len(cmd.Assignments))
 	require.Len(t, cmd.Redirects, len(cmd.Redirects))
 
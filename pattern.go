@@ -0,0 +1,198 @@
+package gobash
+
+import (
+	"unicode"
+)
+
+// Character classes supported in bracket expressions (like [[:alpha:]])
+var bracketCharacterClasses = map[string]func(rune) bool{
+	"alnum":  func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"alpha":  unicode.IsLetter,
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"cntrl":  unicode.IsControl,
+	"digit":  unicode.IsDigit,
+	"graph":  func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) },
+	"lower":  unicode.IsLower,
+	"print":  unicode.IsPrint,
+	"punct":  unicode.IsPunct,
+	"space":  unicode.IsSpace,
+	"upper":  unicode.IsUpper,
+	"xdigit": func(r rune) bool { return unicode.Is(unicode.ASCII_Hex_Digit, r) },
+}
+
+// Returns whether the string matches the pattern according to 2.13.1 Patterns
+// Matching a Single Character and 2.13.2 Patterns Matching Multiple Characters.
+//
+//   - `?` matches any single character
+//   - `*` matches any string, including the empty string
+//   - `[...]` is a bracket expression (negated with `!`)
+//   - `\` quotes the next character so it matches itself
+//
+// A `[` without a matching `]` matches itself.
+func matchPattern(pattern string, str string) bool {
+	p := []rune(pattern)
+	s := []rune(str)
+
+	pi, si := 0, 0
+
+	// the position to backtrack to after a mismatch (the last star)
+	nextPi, nextSi := -1, -1
+
+	for pi < len(p) || si < len(s) {
+		if pi < len(p) {
+			switch p[pi] {
+			case '*':
+				nextPi, nextSi = pi, si+1
+				pi++
+				continue
+			case '?':
+				if si < len(s) {
+					pi++
+					si++
+					continue
+				}
+			case '[':
+				if si < len(s) {
+					if matched, width, ok := matchBracket(p[pi:], s[si]); !ok {
+						// not a bracket expression, match the '[' literally
+						if s[si] == '[' {
+							pi++
+							si++
+							continue
+						}
+					} else if matched {
+						pi += width
+						si++
+						continue
+					}
+				}
+			case '\\':
+				if pi+1 < len(p) {
+					if si < len(s) && s[si] == p[pi+1] {
+						pi += 2
+						si++
+						continue
+					}
+				} else if si < len(s) && s[si] == '\\' {
+					pi++
+					si++
+					continue
+				}
+			default:
+				if si < len(s) && s[si] == p[pi] {
+					pi++
+					si++
+					continue
+				}
+			}
+		}
+
+		if nextSi > 0 && nextSi <= len(s) {
+			pi, si = nextPi, nextSi
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Removes the smallest or the largest prefix (or suffix) of the string that
+// matches the pattern (see 2.6.2 Parameter Expansion). If no prefix (or suffix)
+// matches the pattern, the string is returned as is.
+func removePattern(str string, pattern string, suffix bool, largest bool) string {
+	s := []rune(str)
+
+	for i := 0; i <= len(s); i++ {
+		length := i
+		if largest {
+			length = len(s) - i
+		}
+
+		if suffix && matchPattern(pattern, string(s[len(s)-length:])) {
+			return string(s[:len(s)-length])
+		} else if !suffix && matchPattern(pattern, string(s[:length])) {
+			return string(s[length:])
+		}
+	}
+
+	return str
+}
+
+// Matches a single rune against the bracket expression in the start of the pattern
+// (see 9.3.5 RE Bracket Expression). Returns whether the rune matches, the width
+// of the bracket expression in the pattern and whether the pattern starts with a
+// valid bracket expression.
+func matchBracket(p []rune, r rune) (matched bool, width int, ok bool) {
+	i := 1
+	negate := false
+
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		negate = true
+		i++
+	}
+
+	first := true
+	for i < len(p) {
+		// a ']' right after the opening bracket is a literal
+		if p[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+
+		first = false
+
+		// character class, like [:alpha:]
+		if p[i] == '[' && i+1 < len(p) && p[i+1] == ':' {
+			if end := indexRunes(p[i+2:], ":]"); end >= 0 {
+				class := string(p[i+2 : i+2+end])
+				if f, exists := bracketCharacterClasses[class]; exists && f(r) {
+					matched = true
+				}
+
+				i += 2 + end + 2
+				continue
+			}
+		}
+
+		lo := p[i]
+		if lo == '\\' && i+1 < len(p) {
+			i++
+			lo = p[i]
+		}
+
+		hi := lo
+
+		// range expression, like a-z
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			i += 2
+			hi = p[i]
+			if hi == '\\' && i+1 < len(p) {
+				i++
+				hi = p[i]
+			}
+		}
+
+		if lo <= r && r <= hi {
+			matched = true
+		}
+
+		i++
+	}
+
+	// unterminated bracket expression
+	return false, 0, false
+}
+
+// Returns the index of the first instance of substr in runes, or -1
+func indexRunes(runes []rune, substr string) int {
+	sub := []rune(substr)
+
+	for i := 0; i+len(sub) <= len(runes); i++ {
+		if string(runes[i:i+len(sub)]) == substr {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,61 @@
+package gobash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPattern(t *testing.T) {
+	require.True(t, matchPattern("", ""))
+	require.True(t, matchPattern("abc", "abc"))
+	require.False(t, matchPattern("abc", "abd"))
+	require.False(t, matchPattern("abc", "ab"))
+	require.False(t, matchPattern("ab", "abc"))
+
+	require.True(t, matchPattern("*", ""))
+	require.True(t, matchPattern("*", "abc"))
+	require.True(t, matchPattern("*", "a/b"))
+	require.True(t, matchPattern("a*", "abc"))
+	require.True(t, matchPattern("*c", "abc"))
+	require.True(t, matchPattern("a*c", "abbbc"))
+	require.True(t, matchPattern("a*b*c", "aXbYbZc"))
+	require.True(t, matchPattern("**", "abc"))
+	require.False(t, matchPattern("a*d", "abc"))
+	require.False(t, matchPattern("*b", "abc"))
+
+	require.True(t, matchPattern("?", "a"))
+	require.True(t, matchPattern("a?c", "abc"))
+	require.True(t, matchPattern("???", "שלו"))
+	require.False(t, matchPattern("?", ""))
+	require.False(t, matchPattern("??", "a"))
+
+	require.True(t, matchPattern("[abc]", "b"))
+	require.False(t, matchPattern("[abc]", "d"))
+	require.True(t, matchPattern("[a-c]x", "bx"))
+	require.False(t, matchPattern("[a-c]", "d"))
+	require.True(t, matchPattern("[!a-c]", "d"))
+	require.False(t, matchPattern("[!a-c]", "a"))
+	require.True(t, matchPattern("[^a]", "b"))
+	require.True(t, matchPattern("[]]", "]"))
+	require.True(t, matchPattern("[!]]", "a"))
+	require.True(t, matchPattern("[a-]", "-"))
+	require.True(t, matchPattern("[[:digit:]]*", "1abc"))
+	require.False(t, matchPattern("[[:digit:]]*", "abc"))
+	require.True(t, matchPattern("[[:alpha:][:digit:]]", "a"))
+	require.True(t, matchPattern("[!*]", "a"))
+	require.False(t, matchPattern("[!*]", "*"))
+
+	// unterminated bracket expressions match literally
+	require.True(t, matchPattern("[a", "[a"))
+	require.False(t, matchPattern("[a", "a"))
+
+	// quoting
+	require.True(t, matchPattern(`\*`, "*"))
+	require.False(t, matchPattern(`\*`, "a"))
+	require.True(t, matchPattern(`a\?`, "a?"))
+	require.True(t, matchPattern(`\[a]`, "[a]"))
+	require.True(t, matchPattern(`\\`, `\`))
+	require.True(t, matchPattern(`a\`, `a\`))
+	require.True(t, matchPattern(`[\]]`, "]"))
+}
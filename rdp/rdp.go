@@ -23,6 +23,9 @@ type RDP[T Token, TR Terminal[T]] struct {
 	Tokens []T
 	Index  int
 	err    error
+
+	// the furthest index the parser has reached, even if it backtracked since
+	Furthest int
 }
 
 func (r *RDP[T, TR]) Consume() error {
@@ -36,6 +39,9 @@ func (r *RDP[T, TR]) Consume() error {
 	}
 
 	r.Index++
+	if r.Index > r.Furthest {
+		r.Furthest = r.Index
+	}
 
 	return nil
 }
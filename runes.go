@@ -60,6 +60,22 @@ func isNameRune(r rune) bool {
 	return isAlphabetLetter(r) || isDigit(r) || isUnderscore(r)
 }
 
+// Returns whether the string is a valid name (see 3.235 Name). A name consists
+// of underscores, digits and alphabetics, and does not begin with a digit.
+func isName(str string) bool {
+	if str == "" {
+		return false
+	}
+
+	for i, r := range str {
+		if !isNameRune(r) || (i == 0 && isDigit(r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Returns whether the rune is in the english alphabet (lower and upper).
 func isAlphabetLetter(r rune) bool {
 	return !((r < 'a' || r > 'z') && (r < 'A' || r > 'Z'))
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 
+	"github.com/omerhorev/gobash/ast"
 	"github.com/omerhorev/gobash/command"
 )
 
@@ -20,9 +21,12 @@ var InteractiveDefaultSettings ShellSettings = ShellSettings{
 		NoExec:                   false,
 		OpenFunc:                 nil, // use default os.OpenFile
 		CdFunc:                   nil, // use default fs based implementation
+		HomeDirFunc:              nil, // use default os/user based implementation
+		FS:                       nil, // use the os file system
 		DisableFileOpen:          false,
 		StopOnIORedirectionError: false,
 		StopOnUnknownCommand:     false,
+		TraceFunc:                nil, // write the traces to stderr
 	},
 
 	Interactive: true,
@@ -35,8 +39,12 @@ type Shell struct {
 }
 
 func NewShell(settings ShellSettings) *Shell {
+	executor := NewExecutor(settings.ExecutorSettings)
+	executor.ExecEnv.Options.Interactive = settings.Interactive
+	executor.ExecEnv.ShellName = "gobash"
+
 	return &Shell{
-		executor: NewExecutor(settings.ExecutorSettings),
+		executor: executor,
 		Settings: settings,
 	}
 }
@@ -68,7 +76,14 @@ func (s *Shell) AddCommands(cmd ...command.Command) {
 	s.executor.AddCommands(cmd...)
 }
 
+// Evaluates the expression. When the shell exits (like with the exit special
+// built-in), an ExitError with the exit status of the shell is returned.
 func (s *Shell) Run(expression string) error {
+	// with verbose (set -v), the input is written to stderr as it is read
+	if s.executor.ExecEnv.Options.Verbose {
+		io.WriteString(s.executor.ExecEnv.Stderr(), expression+"\n")
+	}
+
 	tokenizer := NewTokenizerShort(expression)
 
 	tokens, err := tokenizer.ReadAll()
@@ -76,7 +91,7 @@ func (s *Shell) Run(expression string) error {
 		return err
 	}
 
-	parser := NewParser(tokens, ParserSettings{})
+	parser := NewParser(tokens, ParserSettings{Aliases: s.executor.ExecEnv.Aliases})
 
 	if err := parser.Parse(); err != nil {
 		return err
@@ -99,16 +114,14 @@ func (s *Shell) RunInteractive() error {
 	for {
 		// TODO: Prompt
 
-		line, err := lr.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return err
-			}
+		program, err := s.readProgram(lr)
+		if err == io.EOF {
+			break
+		} else if err == nil {
+			err = s.executor.Run(program)
 		}
 
-		if err := s.Run(line); s.handleError(err) != nil {
+		if s.handleError(err) != nil {
 			return err
 		}
 	}
@@ -116,6 +129,63 @@ func (s *Shell) RunInteractive() error {
 	return nil
 }
 
+// Reads the lines of the next complete command, which continues on the following
+// lines when a line ends in the middle of it (like a here-document or an if
+// command without fi), and parses them. With verbose (set -v), the lines are
+// written to stderr as they are read. Returns io.EOF once all the lines were read.
+func (s *Shell) readProgram(lr *LineReader) (*ast.Program, error) {
+	text := ""
+
+	for {
+		line, err := lr.ReadLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		eof := err == io.EOF
+		if eof && line == "" && text == "" {
+			return nil, io.EOF
+		}
+
+		if !eof {
+			line += "\n"
+		}
+
+		if s.executor.ExecEnv.Options.Verbose {
+			io.WriteString(s.executor.ExecEnv.Stderr(), line)
+		}
+
+		text += line
+
+		program, incomplete, err := s.parse(text)
+		if incomplete && !eof {
+			continue
+		}
+
+		return program, err
+	}
+}
+
+// Parses the text into a program. The text is incomplete if it ends in the middle
+// of a command, in which case the program is nil unless only the body of a
+// here-document is missing.
+func (s *Shell) parse(text string) (program *ast.Program, incomplete bool, err error) {
+	tokenizer := NewTokenizerShort(text)
+
+	tokens, err := tokenizer.ReadAll()
+	if err != nil {
+		return nil, errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errUnterminatedQuote), err
+	}
+
+	parser := NewParser(tokens, ParserSettings{Aliases: s.executor.ExecEnv.Aliases})
+
+	if parser.Parse() != nil {
+		return nil, parser.Incomplete(), parser.Error()
+	}
+
+	return parser.Program(), tokenizer.HereDocPending(), nil
+}
+
 func (s *Shell) RunReader(reader io.Reader) error {
 	if !s.Settings.Interactive {
 		return s.RunScript(reader)
@@ -126,22 +196,42 @@ func (s *Shell) RunReader(reader io.Reader) error {
 	return nil
 }
 
-// Evaluate the entire content of the script
+// Evaluate the entire content of the script. The script is read and executed one
+// complete command at a time, so the commands affect the way the following lines
+// are read (like alias or set -v).
 func (s *Shell) RunScript(reader io.Reader) error {
-	tokenizer := NewTokenizerLong(reader)
+	lr := NewLineReader(reader)
 
-	tokens, err := tokenizer.ReadAll()
-	if err != nil {
-		return err
-	}
+	for {
+		program, err := s.readProgram(lr)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
 
-	parser := NewParser(tokens, ParserSettings{})
+		if err := s.executor.Run(program); err != nil {
+			return err
+		}
+	}
+}
 
-	if err := parser.Parse(); err != nil {
-		return err
+// Evaluate the entire content of the script with the arguments provided. The
+// first argument is the name of the script ($0) and the rest are the positional
+// parameters ($1, $2, ...).
+func (s *Shell) RunScriptArgs(reader io.Reader, args []string) error {
+	if len(args) > 0 {
+		s.executor.ExecEnv.ShellName = args[0]
+		s.executor.ExecEnv.PositionalParams = append([]string{}, args[1:]...)
 	}
 
-	return s.executor.Run(parser.Program())
+	return s.RunScript(reader)
+}
+
+// Returns the exit status of the shell, which is the exit status of the last
+// command executed or the exit status the shell exited with.
+func (s *Shell) ExitStatus() int {
+	return s.executor.ExecEnv.Status
 }
 
 func (s *Shell) handleError(err error) error {
@@ -150,7 +240,9 @@ func (s *Shell) handleError(err error) error {
 	}
 
 	if errors.Is(err, SyntaxError{}) ||
-		errors.Is(err, IoRedirectionError{}) {
+		errors.Is(err, IoRedirectionError{}) ||
+		errors.Is(err, ExpansionError{}) ||
+		errors.Is(err, AssignmentError{}) {
 		return nil
 	} else {
 		return err
@@ -0,0 +1,63 @@
+package gobash
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/omerhorev/gobash/command"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellInteractiveHereDoc(t *testing.T) {
+	s := NewShell(InteractiveDefaultSettings)
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	s.SetStdout(&b)
+	s.SetStderr(&stderr)
+	s.AddCommands(command.Default...)
+	s.AddCommands(testCopyCommand)
+
+	// the body of a here-document is read from the lines that follow its operator
+	s.SetStdin(strings.NewReader("x=1\ncopy <<EOF; copy <<'E'\na $x\nEOF\nb $x\nE\necho end\ncopy <<EOF\nno delimiter"))
+	require.NoError(t, s.RunInteractive())
+	require.Equal(t, "a 1\nb $x\nend\nno delimiter", b.String())
+	require.Empty(t, stderr.String())
+}
+
+func TestShellScript(t *testing.T) {
+	s := NewShell(ShellSettings{})
+	b := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	s.SetStdout(&b)
+	s.SetStderr(&stderr)
+	s.AddCommands(command.Default...)
+
+	// commands may span over several lines
+	require.NoError(t, s.RunScript(strings.NewReader("if true\nthen\n  echo a\nfi\nf() {\n  echo \"$1\"\n}\nf 'b\nc'\ntrue &&\n  echo d\n")))
+	require.Equal(t, "a\nb\nc\nd\n", b.String())
+	require.Empty(t, stderr.String())
+
+	// set -v affects the lines read after it
+	b.Reset()
+	require.NoError(t, s.RunScript(strings.NewReader("echo a\nset -v\necho b\nif true; then\n  echo c\nfi\n")))
+	require.Equal(t, "a\nb\nc\n", b.String())
+	require.Equal(t, "echo b\nif true; then\n  echo c\nfi\n", stderr.String())
+
+	// a syntax error stops the script
+	b.Reset()
+	stderr.Reset()
+	s.executor.ExecEnv.Options.Verbose = false
+	err := s.RunScript(strings.NewReader("echo a\nfi\necho b\n"))
+	require.ErrorIs(t, err, SyntaxError{})
+	require.False(t, IsReportedError(err))
+	require.Equal(t, "a\n", b.String())
+
+	// the errors of the commands are reported by the shell
+	b.Reset()
+	err = s.RunScript(strings.NewReader("readonly r\nr=1\necho b\n"))
+	require.ErrorIs(t, err, AssignmentError{})
+	require.True(t, IsReportedError(err))
+	require.Equal(t, "r: readonly variable\n", stderr.String())
+	require.Empty(t, b.String())
+}
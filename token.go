@@ -5,7 +5,7 @@ import "unicode/utf8"
 var (
 	operatorsStrings = []string{
 		"&&", "||", ";;", "<<", ">>", "<&", ">&", "<>", "<<-", ">|",
-		"&", "|", ";", "<", ">",
+		"&", "|", ";", "<", ">", "(", ")",
 	}
 
 	reservedWordsStrings = []string{
@@ -35,6 +35,28 @@ var (
 	tokenIdentifierDGreat         = TokenIdentifier(">>")
 	tokenIdentifierLessGreat      = TokenIdentifier("<>")
 	tokenIdentifierClobber        = TokenIdentifier(">|")
+	tokenIdentifierDLess          = TokenIdentifier("<<")
+	tokenIdentifierDLessDash      = TokenIdentifier("<<-")
+	tokenIdentifierDSemicolon     = TokenIdentifier(";;")
+	tokenIdentifierLParen         = TokenIdentifier("(")
+	tokenIdentifierRParen         = TokenIdentifier(")")
+
+	// reserved words
+	tokenIdentifierIf     = TokenIdentifier("if")
+	tokenIdentifierThen   = TokenIdentifier("then")
+	tokenIdentifierElif   = TokenIdentifier("elif")
+	tokenIdentifierElse   = TokenIdentifier("else")
+	tokenIdentifierFi     = TokenIdentifier("fi")
+	tokenIdentifierWhile  = TokenIdentifier("while")
+	tokenIdentifierUntil  = TokenIdentifier("until")
+	tokenIdentifierDo     = TokenIdentifier("do")
+	tokenIdentifierDone   = TokenIdentifier("done")
+	tokenIdentifierFor    = TokenIdentifier("for")
+	tokenIdentifierIn     = TokenIdentifier("in")
+	tokenIdentifierCase   = TokenIdentifier("case")
+	tokenIdentifierEsac   = TokenIdentifier("esac")
+	tokenIdentifierLBrace = TokenIdentifier("{")
+	tokenIdentifierRBrace = TokenIdentifier("}")
 )
 
 func (t TokenIdentifier) Accept(token *Token) bool {
@@ -51,6 +73,19 @@ func (t TokenIdentifier) String() string {
 type Token struct {
 	Value      string          // The actual value of the token
 	Identifier TokenIdentifier // The type of token, also a RDP terminal
+
+	// The body of the here-document delimited by this token (the word after << or
+	// <<-). The body is read by the Tokenizer after the end of the line, so it is
+	// set only once the next newline token is read.
+	HereDoc string
+
+	// The aliases whose substitution produced the token. An alias is not
+	// substituted again in its own value, to prevent recursive substitution.
+	aliases map[string]bool
+
+	// The token follows the value of an alias that ends with a blank, so it is
+	// also checked for alias substitution
+	afterAlias bool
 }
 
 // Returns whether a token is of specific type.
@@ -107,12 +142,9 @@ func (t *Token) tryUpgradeToReservedWord() bool {
 	for _, r := range reservedWordsStrings {
 		if r == t.Value {
 			t.Identifier = TokenIdentifier(r)
-		}
-	}
-	if t.Value == "!" {
-		t.Identifier = tokenIdentifierBang
 
-		return true
+			return true
+		}
 	}
 
 	return false
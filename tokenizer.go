@@ -14,6 +14,9 @@ var (
 	defaultLongTokensCount  = 200
 )
 
+// The input ended inside a quoted string
+var errUnterminatedQuote = errors.New("unterminated quoted string")
+
 // used to alter the behavior of the tokenizer
 type TokenizerSettings struct {
 	// used for tokens memory allocation
@@ -28,6 +31,18 @@ type Tokenizer struct {
 	reader   *bufio.Reader
 	settings TokenizerSettings
 	err      error
+
+	last     *Token           // the last token read
+	hereDocs []pendingHereDoc // here-documents whose body is read after the line
+
+	// a here-document body ended without its delimiter line
+	hereDocUnterminated bool
+}
+
+// A here-document operator (<< or <<-) whose body was not read yet
+type pendingHereDoc struct {
+	delimiter *Token
+	stripTabs bool
 }
 
 // Create a tokenizer that is optimized for short expressions (usually received
@@ -77,6 +92,11 @@ func (t *Tokenizer) ReadToken() (*Token, error) {
 		return nil, err
 	}
 
+	if err := t.collectHereDocs(token); err != nil {
+		t.err = err
+		return nil, err
+	}
+
 	if token.IsEOF() {
 		// the next call will produce an io.EOF error
 		t.err = io.EOF
@@ -110,6 +130,104 @@ func (t *Tokenizer) ReadAll() ([]*Token, error) {
 	return tokens, nil
 }
 
+// Returns whether the input read so far ends inside a here-document: the line of
+// a here-document operator did not end yet, or the body of a here-document has
+// no delimiter line. An interactive shell reads more lines in that case.
+func (t *Tokenizer) HereDocPending() bool {
+	return len(t.hereDocs) > 0 || t.hereDocUnterminated
+}
+
+// Keeps track of the here-documents in the current line, and reads their bodies
+// once the line ends (see 2.7.4 Here-Document)
+func (t *Tokenizer) collectHereDocs(token *Token) error {
+	last := t.last
+	t.last = token
+
+	if last != nil && (last.Is(tokenIdentifierDLess) || last.Is(tokenIdentifierDLessDash)) &&
+		token.Is(tokenIdentifierWord) {
+		t.hereDocs = append(t.hereDocs, pendingHereDoc{
+			delimiter: token,
+			stripTabs: last.Is(tokenIdentifierDLessDash),
+		})
+	}
+
+	if !token.Is(tokenIdentifierNewline) {
+		return nil
+	}
+
+	for _, h := range t.hereDocs {
+		delimiter, _ := hereDocDelimiter(h.delimiter.Value)
+
+		body, err := t.readHereDoc(delimiter, h.stripTabs)
+		if err != nil {
+			return err
+		}
+
+		h.delimiter.HereDoc = body
+	}
+
+	t.hereDocs = nil
+
+	return nil
+}
+
+// Reads the lines of a here-document up to the line that contains only the
+// delimiter. With stripTabs (<<-), the leading tabs of the lines are removed. A
+// here-document that is not delimited ends at the end of the input.
+func (t *Tokenizer) readHereDoc(delimiter string, stripTabs bool) (string, error) {
+	body := strings.Builder{}
+
+	for {
+		line, err := t.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		content := strings.TrimSuffix(line, "\n")
+		if stripTabs {
+			content = strings.TrimLeft(content, "\t")
+		}
+
+		if content == delimiter {
+			return body.String(), nil
+		}
+
+		if err == io.EOF {
+			body.WriteString(content)
+			t.hereDocUnterminated = true
+			return body.String(), nil
+		}
+
+		body.WriteString(content + "\n")
+	}
+}
+
+// Returns the delimiter of a here-document after quote removal, and whether any
+// part of the word is quoted, which disables the expansions in the body.
+func hereDocDelimiter(word string) (delimiter string, quoted bool) {
+	b := strings.Builder{}
+	quote := rune(0)
+	escaped := false
+
+	for _, r := range word {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteRune(r)
+		case r == '\\' && quote != '\'':
+			escaped, quoted = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote, quoted = r, true
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String(), quoted
+}
+
 func (t *Tokenizer) readToken() (*Token, error) {
 	if t.err != nil {
 		return nil, t.err
@@ -206,7 +324,8 @@ func (t *Tokenizer) readToken() (*Token, error) {
 			continue
 		}
 
-		if !preserveMeaning() && isExpressionStart(r) {
+		// expansions are also recognized inside double quotes
+		if !(isBackslashed || isApostrophed) && isExpressionStart(r) {
 			t.reader.UnreadRune()
 
 			expr, err := t.readExpression()
@@ -215,6 +334,7 @@ func (t *Tokenizer) readToken() (*Token, error) {
 			}
 
 			tokenStr += expr
+			continue
 		}
 
 		if isApostrophed && isApostrophe(r) {
@@ -260,9 +380,13 @@ func (t *Tokenizer) readToken() (*Token, error) {
 			}
 		}
 
-		// rule #8, comment
-		if !preserveMeaning() && isNumberSign(r) {
-			break
+		// rule #8, comment. The comment is discarded up to the newline
+		if !preserveMeaning() && isNumberSign(r) && tokenStr == "" {
+			if err := t.skipComment(); err != nil {
+				return nil, err
+			}
+
+			return t.readToken()
 		}
 
 		if !preserveMeaning() && isNewLine(r) {
@@ -282,12 +406,30 @@ func (t *Tokenizer) readToken() (*Token, error) {
 	}
 
 	if isApostrophed || isQuotationMarked {
-		return nil, newSyntaxError(errors.New("unterminated quoted string"))
+		return nil, newSyntaxError(errUnterminatedQuote)
 	}
 
 	return newTokenFromString(tokenStr, utf8.RuneError), nil
 }
 
+// Discards the runes of a comment, up to the newline that ends it
+func (t *Tokenizer) skipComment() error {
+	for {
+		r, _, err := t.reader.ReadRune()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if isNewLine(r) {
+			return t.reader.UnreadRune()
+		}
+	}
+}
+
+// reads an expression (like `x` or ${x}) from the stream and returns its text,
+// including the delimiters. The expression is a part of the current word.
 func (t *Tokenizer) readExpression() (string, error) {
 	r, _, err := t.reader.ReadRune()
 	if err != nil {
@@ -300,17 +442,66 @@ func (t *Tokenizer) readExpression() (string, error) {
 			return "", err
 		}
 
-		return "`" + result, nil
+		return "`" + result + "`", nil
+	}
+
+	if isDollarSign(r) {
+		next, _, err := t.reader.ReadRune()
+		if err == io.EOF {
+			return "$", nil
+		} else if err != nil {
+			return "", err
+		}
+
+		if next == '(' {
+			result, err := t.readUntilUnescapedNested("(", ")")
+			if err != nil {
+				return "", err
+			}
+
+			return "$(" + result + ")", nil
+		}
+
+		if next == '{' {
+			result, err := t.readUntilUnescaped("}")
+			if err != nil {
+				return "", err
+			}
+
+			return "${" + result + "}", nil
+		}
+
+		// a special parameter is read entirely, so $# is not taken as a comment
+		if strings.ContainsRune(specialParams, next) {
+			return "$" + string(next), nil
+		}
+
+		// a simple parameter ($x) is read as a part of the word
+		if err := t.reader.UnreadRune(); err != nil {
+			return "", err
+		}
+
+		return "$", nil
 	}
 
 	return "", errors.New("unexpected expression")
 }
 
 func (t *Tokenizer) readUntilUnescaped(suffix string) (string, error) {
+	return t.readUntilUnescapedNested("", suffix)
+}
+
+// Reads until the unescaped suffix that closes the unescaped prefix, so nested
+// pairs (like the parentheses of `$( (a) )`) are read entirely. If the prefix
+// is empty, reads until the first unescaped suffix.
+func (t *Tokenizer) readUntilUnescapedNested(prefix string, suffix string) (string, error) {
 	if t.err != nil {
 		return "", t.err
 	}
 
+	depth := 0
+	program := newProgramTracker()
+
 	isBackslashed := false
 	isApostrophed := false
 	isQuotationMarked := false
@@ -329,8 +520,29 @@ func (t *Tokenizer) readUntilUnescaped(suffix string) (string, error) {
 			return "", err
 		}
 
+		// the comments and the bodies of here-documents of programs are read as is
+		if prefix != "" && program.skipping() {
+			program.add(r, false, depth)
+			str += string(r)
+			continue
+		}
+
+		program.add(r, preserveMeaning() || isEscape(r) || isQuotationMark(r) || isApostrophe(r), depth)
+
+		if !preserveMeaning() && prefix != "" && strings.HasSuffix(str+string(r), prefix) {
+			depth++
+			str += string(r)
+			continue
+		}
+
 		if !preserveMeaning() && strings.HasSuffix(str+string(r), suffix) {
-			return str, nil
+			if prefix != "" && program.closesPattern(depth) {
+				// the suffix ends a case pattern, like the `)` of `$(case a in a) b;; esac)`
+			} else if depth == 0 {
+				return str, nil
+			} else {
+				depth--
+			}
 		}
 
 		if !(isBackslashed || isApostrophed) && isEscape(r) {
@@ -357,7 +569,8 @@ func (t *Tokenizer) readUntilUnescaped(suffix string) (string, error) {
 			continue
 		}
 
-		if !preserveMeaning() && isExpressionStart(r) {
+		// expansions are also recognized inside double quotes
+		if !(isBackslashed || isApostrophed) && isExpressionStart(r) {
 			t.reader.UnreadRune()
 
 			expr, err := t.readExpression()
@@ -366,6 +579,7 @@ func (t *Tokenizer) readUntilUnescaped(suffix string) (string, error) {
 			}
 
 			str += expr
+			continue
 		}
 
 		if isApostrophed && isApostrophe(r) {
@@ -380,6 +594,189 @@ func (t *Tokenizer) readUntilUnescaped(suffix string) (string, error) {
 	}
 }
 
+// Tracks the program in the text of a command substitution, so the end of the
+// substitution is found by the rules of the program: the parentheses that end
+// case patterns (like `$(case a in a) b;; esac)`), and the comments and the
+// bodies of here-documents, are not taken as the end of the substitution. The
+// reserved words are recognized by their position in the command, which is
+// enough to find the case commands.
+type programTracker struct {
+	// the parentheses depth of each open case command
+	depths []int
+
+	// the current word, and whether a part of it is quoted
+	word   string
+	quoted bool
+
+	// the current word is the first word of a command
+	commandStart bool
+
+	// the words left until the `in` of the last case command
+	subject int
+
+	// the previous unquoted rune
+	prev rune
+
+	// the rest of the line is a comment
+	comment bool
+
+	// the next word is the delimiter of a here-document, and whether the leading
+	// tabs of its lines are removed (<<-)
+	delimiterNext bool
+	stripTabs     bool
+
+	// the here-documents whose bodies follow the current line, the body that is
+	// read, and its current line
+	hereDocs []trackedHereDoc
+	inBody   bool
+	line     string
+}
+
+type trackedHereDoc struct {
+	delimiter string
+	stripTabs bool
+}
+
+func newProgramTracker() programTracker {
+	return programTracker{commandStart: true}
+}
+
+// Returns whether the runes are inside a comment or the body of a here-document,
+// where they have no special meaning
+func (c *programTracker) skipping() bool {
+	return c.comment || c.inBody
+}
+
+// Adds a rune of the text at the given parentheses depth. Quoted runes are never
+// a part of reserved words or operators.
+func (c *programTracker) add(r rune, quoted bool, depth int) {
+	if c.inBody {
+		c.addBodyRune(r)
+		return
+	}
+
+	if c.comment {
+		if r != '\n' {
+			return
+		}
+
+		c.comment = false
+	}
+
+	if quoted {
+		c.word += string(r)
+		c.quoted = true
+		c.prev = 0
+		return
+	}
+
+	switch r {
+	case '#':
+		// a comment starts at the beginning of a word
+		if c.word == "" && !c.quoted {
+			c.comment = true
+		} else {
+			c.word += string(r)
+		}
+	case '-':
+		if c.prev == '<' && c.delimiterNext {
+			c.stripTabs = true
+		} else {
+			c.word += string(r)
+		}
+	case ' ', '\t', '>':
+		c.endWord(depth)
+	case '<':
+		c.endWord(depth)
+		if c.prev == '<' {
+			c.delimiterNext = true
+			c.stripTabs = false
+		}
+	case '\n':
+		c.endWord(depth)
+		c.commandStart = true
+
+		// the bodies of the here-documents start on the next line
+		c.inBody = len(c.hereDocs) > 0
+	case ';', '&', '|', '(', ')':
+		c.endWord(depth)
+		c.commandStart = true
+	default:
+		c.word += string(r)
+	}
+
+	if r == '<' || r == '>' {
+		c.commandStart = false
+	}
+
+	c.prev = r
+}
+
+// Adds a rune of the body of the current here-document, which ends by a line
+// of its delimiter
+func (c *programTracker) addBodyRune(r rune) {
+	if r != '\n' {
+		c.line += string(r)
+		return
+	}
+
+	line := c.line
+	c.line = ""
+
+	if c.hereDocs[0].stripTabs {
+		line = strings.TrimLeft(line, "\t")
+	}
+
+	if line == c.hereDocs[0].delimiter {
+		c.hereDocs = c.hereDocs[1:]
+		c.inBody = len(c.hereDocs) > 0
+	}
+}
+
+func (c *programTracker) endWord(depth int) {
+	word, reserved := c.word, c.commandStart && !c.quoted
+	if word == "" && !c.quoted {
+		return
+	}
+
+	c.word, c.quoted = "", false
+	c.commandStart = false
+
+	if c.delimiterNext {
+		delimiter, _ := hereDocDelimiter(word)
+		c.hereDocs = append(c.hereDocs, trackedHereDoc{delimiter: delimiter, stripTabs: c.stripTabs})
+		c.delimiterNext = false
+		return
+	}
+
+	if c.subject > 0 {
+		c.subject--
+		c.commandStart = c.subject == 0 && word == "in"
+		return
+	}
+
+	if !reserved {
+		return
+	}
+
+	switch word {
+	case "case":
+		c.depths = append(c.depths, depth)
+		c.subject = 2
+	case "esac":
+		if len(c.depths) > 0 {
+			c.depths = c.depths[:len(c.depths)-1]
+		}
+	case "if", "then", "else", "elif", "while", "until", "do", "!", "{":
+		c.commandStart = true
+	}
+}
+
+// Returns whether a closing parenthesis at the given depth ends a case pattern
+func (c *programTracker) closesPattern(depth int) bool {
+	return len(c.depths) > 0 && c.depths[len(c.depths)-1] == depth
+}
+
 func canBeUsedInOperator(token string) bool {
 	for _, o := range operatorsStrings {
 		if strings.HasPrefix(o, token) {
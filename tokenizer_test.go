@@ -60,6 +60,42 @@ func TestTokenExpressions(t *testing.T) {
 	testTokens(t, "`x 'y'`", "`x 'y'`")
 	testTokens(t, "`x 'y\"y\"'`", "`x 'y\"y\"'`")
 
+	// parameters
+	testTokens(t, "$x y", "$x", "y")
+	testTokens(t, "$x$y", "$x$y")
+	testTokens(t, "${x} y", "${x}", "y")
+	testTokens(t, "a${x}b", "a${x}b")
+	testTokens(t, "${x:-a b}", "${x:-a b}")
+	testTokens(t, "${x:-'}'} y", "${x:-'}'}", "y")
+	testTokens(t, "${x:-${y}} z", "${x:-${y}}", "z")
+	testTokens(t, "${x:-`a}`}", "${x:-`a}`}")
+	testTokens(t, "$# a$?b $$", "$#", "a$?b", "$$")
+	testTokens(t, "$ x $", "$", "x", "$")
+	testTokens(t, "$x>y", "$x", ">", "y")
+
+	// command substitutions
+	testTokens(t, "$(a b) c", "$(a b)", "c")
+	testTokens(t, "x$(a; b)y", "x$(a; b)y")
+	testTokens(t, "$(a $(b c)) d", "$(a $(b c))", "d")
+	testTokens(t, "$( (a) ) b", "$( (a) )", "b")
+	testTokens(t, "\"$(a \"b c\")\" d", "\"$(a \"b c\")\"", "d")
+	testTokens(t, "\"`a \\\"b c\\\"`\" d", "\"`a \\\"b c\\\"`\"", "d")
+	testTokens(t, "$(a ')' \\)) b", "$(a ')' \\))", "b")
+
+	// the parentheses of case patterns don't end command substitutions
+	testTokens(t, "$(case a in a) b;; esac) c", "$(case a in a) b;; esac)", "c")
+	testTokens(t, "$(case a in (a) b;; esac) c", "$(case a in (a) b;; esac)", "c")
+	testTokens(t, "$(case a in esac) c", "$(case a in esac)", "c")
+	testTokens(t, "$(echo case) c", "$(echo case)", "c")
+	testTokens(t, "$(case a in a) $(case b in b) c;; esac);; esac) d", "$(case a in a) $(case b in b) c;; esac);; esac)", "d")
+
+	// neither do the parentheses of comments and here-documents
+	testTokens(t, "$(a # b)\n) c", "$(a # b)\n)", "c")
+	testTokens(t, "$(a '#' b) c", "$(a '#' b)", "c")
+	testTokens(t, "$(a <<X\n)\nX\n) c", "$(a <<X\n)\nX\n)", "c")
+	testTokens(t, "$(a <<-'X' # (\n\t)\n\tX\nb) c", "$(a <<-'X' # (\n\t)\n\tX\nb)", "c")
+	testTokens(t, "$(a <<X; b <<Y\n)\nX\n)\nY\n) c", "$(a <<X; b <<Y\n)\nX\n)\nY\n)", "c")
+
 	// nested
 	testTokens(t, "`\\`x\\``", "`\\`x\\``")
 	testTokens(t, "`abc \\`a \\\\`b\\\\` c\\``", "`abc \\`a \\\\`b\\\\` c\\``")
@@ -76,6 +112,43 @@ cat x`, "ls", "y", "\n", "cat", "x")
 x`, "ls", "yx")
 }
 
+func TestTokenComments(t *testing.T) {
+	testTokens(t, "ls # a b", "ls")
+	testTokens(t, "ls #a\ncat # b\n#c", "ls", "\n", "cat", "\n")
+	testTokens(t, "ls a#b '#'c", "ls", "a#b", "'#'c")
+	testTokens(t, "cat <<EOF # a\nb\nEOF\nls", "cat", "<<", "EOF", "\n", "ls")
+}
+
+func TestTokenHereDoc(t *testing.T) {
+	testTokens(t, "cat <<EOF\na\nb\nEOF\nls", "cat", "<<", "EOF", "\n", "ls")
+	testTokens(t, "cat <<-EOF x\n\ta\n\tEOF\n", "cat", "<<-", "EOF", "x", "\n")
+
+	tokenizer := NewTokenizerShort("a <<EOF; b <<-'E F'\n$x\nEOF\n\ty\n\tE F\nc <<EOF\nEOF")
+	tokens, err := tokenizer.ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, "$x\n", tokens[2].HereDoc)
+	require.Equal(t, "y\n", tokens[6].HereDoc)
+	require.Equal(t, "", tokens[10].HereDoc)
+	require.True(t, tokens[12].IsEOF())
+	require.False(t, tokenizer.HereDocPending())
+
+	// the input ends inside a here-document
+	for _, text := range []string{"cat <<EOF", "cat <<EOF\n", "cat <<EOF\na\n", "a <<A; b <<B\nA\n"} {
+		tokenizer = NewTokenizerShort(text)
+		_, err = tokenizer.ReadAll()
+		require.NoError(t, err)
+		require.True(t, tokenizer.HereDocPending(), text)
+	}
+
+	delimiter, quoted := hereDocDelimiter(`"E"O\F'x'`)
+	require.Equal(t, "EOFx", delimiter)
+	require.True(t, quoted)
+
+	delimiter, quoted = hereDocDelimiter("EOF")
+	require.Equal(t, "EOF", delimiter)
+	require.False(t, quoted)
+}
+
 func testTokens(t *testing.T, line string, tokensStr ...string) {
 	tokenizer := NewTokenizerShort(line)
 